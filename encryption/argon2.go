@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrMismatchedPassword delivered when the password does not match the hash
+var ErrMismatchedPassword = errors.New("Password does not match hash")
+
+// ErrInvalidHash delivered when the hash is not in the expected format
+var ErrInvalidHash = errors.New("Invalid hash format")
+
+// Default Argon2id parameters, following RFC 9106 recommendations for constrained memory
+const (
+	DefaultArgon2Memory      = 64 * 1024
+	DefaultArgon2Time        = 3
+	DefaultArgon2Parallelism = 4
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// Argon2idEncrypter implementation storing hashes as PHC strings, zero
+// parameters use the defaults. Memory is in KiB
+type Argon2idEncrypter struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+type argon2Params struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+}
+
+func (a *Argon2idEncrypter) Encrypt(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	params := a.params()
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.time, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Compare delivers nil when password matches the hash, using the parameters stored in it
+func (a *Argon2idEncrypter) Compare(hash string, password string) error {
+	params, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+
+	got := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+// NeedsRehash delivers true for hashes that are not Argon2id or use other parameters
+func (a *Argon2idEncrypter) NeedsRehash(hash string) bool {
+	params, _, _, err := parseArgon2Hash(hash)
+	return err != nil || params != a.params()
+}
+
+func (a *Argon2idEncrypter) params() argon2Params {
+	params := argon2Params{a.Memory, a.Time, a.Parallelism}
+	if params.memory == 0 {
+		params.memory = DefaultArgon2Memory
+	}
+	if params.time == 0 {
+		params.time = DefaultArgon2Time
+	}
+	if params.parallelism == 0 {
+		params.parallelism = DefaultArgon2Parallelism
+	}
+	return params
+}
+
+func parseArgon2Hash(hash string) (params argon2Params, salt []byte, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,106 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgon2idEncrypter(t *testing.T) {
+	sut := &Argon2idEncrypter{Memory: 8, Time: 1, Parallelism: 1}
+
+	t.Run("Delivers self describing PHC string", func(t *testing.T) {
+		hash, err := sut.Encrypt("test")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		if !strings.HasPrefix(hash, "$argon2id$v=19$m=8,t=1,p=1$") {
+			t.Errorf("got %q, want argon2id PHC string", hash)
+		}
+	})
+
+	t.Run("Salts every hash", func(t *testing.T) {
+		first, _ := sut.Encrypt("test")
+		second, _ := sut.Encrypt("test")
+
+		if first == second {
+			t.Errorf("got equal hashes, want different salts")
+		}
+	})
+
+	t.Run("Compares using the parameters stored in the hash", func(t *testing.T) {
+		hash, _ := (&Argon2idEncrypter{Memory: 16, Time: 2, Parallelism: 2}).Encrypt("test")
+
+		if err := sut.Compare(hash, "test"); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+
+		if err := sut.Compare(hash, "wrong"); err != ErrMismatchedPassword {
+			t.Errorf("got %v, want %v", err, ErrMismatchedPassword)
+		}
+	})
+
+	t.Run("Delivers ErrInvalidHash on malformed hash", func(t *testing.T) {
+		bcryptHash, _ := (&BCryptEncrypter{Cost: 4}).Encrypt("test")
+
+		for _, hash := range []string{"", "not-a-hash", bcryptHash, "$argon2id$v=18$m=8,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=8,t=1,p=1$c2FsdA$"} {
+			if err := sut.Compare(hash, "test"); err != ErrInvalidHash {
+				t.Errorf("got %v for %q, want %v", err, hash, ErrInvalidHash)
+			}
+		}
+	})
+
+	t.Run("Needs rehash for outdated parameters or algorithm", func(t *testing.T) {
+		current, _ := sut.Encrypt("test")
+		outdated, _ := (&Argon2idEncrypter{Memory: 16, Time: 1, Parallelism: 1}).Encrypt("test")
+		bcryptHash, _ := (&BCryptEncrypter{Cost: 4}).Encrypt("test")
+
+		assertNeedsRehash(t, sut, current, false)
+		assertNeedsRehash(t, sut, outdated, true)
+		assertNeedsRehash(t, sut, bcryptHash, true)
+	})
+
+	t.Run("Uses default parameters when unset", func(t *testing.T) {
+		got := (&Argon2idEncrypter{}).params()
+
+		if got != (argon2Params{DefaultArgon2Memory, DefaultArgon2Time, DefaultArgon2Parallelism}) {
+			t.Errorf("got %+v, want defaults", got)
+		}
+	})
+}
+
+func TestMigratingEncrypter(t *testing.T) {
+	current := &Argon2idEncrypter{Memory: 8, Time: 1, Parallelism: 1}
+	legacy := &BCryptEncrypter{Cost: 4}
+	sut := &MigratingEncrypter{Current: current, Legacy: []Encrypter{legacy}}
+
+	t.Run("Hashes with the current encrypter", func(t *testing.T) {
+		hash, _ := sut.Encrypt("test")
+
+		assertNeedsRehash(t, current, hash, false)
+	})
+
+	t.Run("Verifies current and legacy hashes", func(t *testing.T) {
+		currentHash, _ := current.Encrypt("test")
+		legacyHash, _ := legacy.Encrypt("test")
+
+		for _, hash := range []string{currentHash, legacyHash} {
+			if err := sut.Compare(hash, "test"); err != nil {
+				t.Errorf("got %v for %q, want nil", err, hash)
+			}
+
+			if err := sut.Compare(hash, "wrong"); err == nil {
+				t.Errorf("got nil for %q, want failure", hash)
+			}
+		}
+	})
+
+	t.Run("Needs rehash for legacy hashes only", func(t *testing.T) {
+		currentHash, _ := current.Encrypt("test")
+		legacyHash, _ := legacy.Encrypt("test")
+
+		assertNeedsRehash(t, sut, currentHash, false)
+		assertNeedsRehash(t, sut, legacyHash, true)
+	})
+}
@@ -4,13 +4,35 @@ import "golang.org/x/crypto/bcrypt"
 
 // Encrypter password interface
 type Encrypter interface {
-	Encrypt(password string, cost int) (string, error)
+	Encrypt(password string) (string, error)
+	Compare(hash string, password string) error
+	NeedsRehash(hash string) bool
 }
 
-// BCryptEncrypter implementation
-type BCryptEncrypter struct{}
+// BCryptEncrypter implementation, a zero Cost uses bcrypt.DefaultCost
+type BCryptEncrypter struct {
+	Cost int
+}
 
-func (bc *BCryptEncrypter) Encrypt(password string, cost int) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+func (bc *BCryptEncrypter) Encrypt(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bc.cost())
 	return string(hash), err
 }
+
+// Compare delivers nil when password matches the bcrypt hash
+func (bc *BCryptEncrypter) Compare(hash string, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// NeedsRehash delivers true for hashes that are not bcrypt or use another cost
+func (bc *BCryptEncrypter) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != bc.cost()
+}
+
+func (bc *BCryptEncrypter) cost() int {
+	if bc.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return bc.Cost
+}
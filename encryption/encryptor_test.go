@@ -6,8 +6,8 @@ import (
 
 func TestBCryptEncrypter(t *testing.T) {
 	t.Run("Deliver error on bcrypt failure", func(t *testing.T) {
-		sut := BCryptEncrypter{}
-		_, err := sut.Encrypt("test", 99)
+		sut := BCryptEncrypter{Cost: 99}
+		_, err := sut.Encrypt("test")
 
 		if err == nil {
 			t.Errorf("got nil, want failure")
@@ -15,8 +15,8 @@ func TestBCryptEncrypter(t *testing.T) {
 	})
 
 	t.Run("Delivers crypted password", func(t *testing.T) {
-		sut := BCryptEncrypter{}
-		cryptedPassword, err := sut.Encrypt("test", 10)
+		sut := BCryptEncrypter{Cost: 10}
+		cryptedPassword, err := sut.Encrypt("test")
 
 		if err != nil {
 			t.Errorf("got failure, want nil")
@@ -27,3 +27,49 @@ func TestBCryptEncrypter(t *testing.T) {
 		}
 	})
 }
+
+func TestBCryptCompare(t *testing.T) {
+	sut := BCryptEncrypter{Cost: 4}
+	hash, _ := sut.Encrypt("test")
+
+	t.Run("Delivers nil on matching password", func(t *testing.T) {
+		if err := sut.Compare(hash, "test"); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	})
+
+	t.Run("Delivers error on wrong password", func(t *testing.T) {
+		if err := sut.Compare(hash, "wrong"); err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+
+	t.Run("Delivers error on malformed hash", func(t *testing.T) {
+		if err := sut.Compare("not-a-hash", "test"); err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+func TestBCryptNeedsRehash(t *testing.T) {
+	hash, _ := (&BCryptEncrypter{Cost: 4}).Encrypt("test")
+
+	t.Run("Delivers false for hash with the same cost", func(t *testing.T) {
+		assertNeedsRehash(t, &BCryptEncrypter{Cost: 4}, hash, false)
+	})
+
+	t.Run("Delivers true for hash with another cost", func(t *testing.T) {
+		assertNeedsRehash(t, &BCryptEncrypter{Cost: 5}, hash, true)
+	})
+
+	t.Run("Delivers true for hash of another algorithm", func(t *testing.T) {
+		assertNeedsRehash(t, &BCryptEncrypter{Cost: 4}, "$argon2id$v=19$m=8,t=1,p=1$c2FsdA$a2V5", true)
+	})
+}
+
+func assertNeedsRehash(t *testing.T, sut Encrypter, hash string, want bool) {
+	t.Helper()
+	if got := sut.NeedsRehash(hash); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package encryption
+
+// MigratingEncrypter hashes with Current while still verifying hashes made by
+// Legacy encrypters, reporting those as needing a rehash
+type MigratingEncrypter struct {
+	Current Encrypter
+	Legacy  []Encrypter
+}
+
+func (m *MigratingEncrypter) Encrypt(password string) (string, error) {
+	return m.Current.Encrypt(password)
+}
+
+// Compare delivers nil when any of the encrypters matches the password
+func (m *MigratingEncrypter) Compare(hash string, password string) error {
+	err := m.Current.Compare(hash, password)
+	for _, legacy := range m.Legacy {
+		if err == nil {
+			return nil
+		}
+		err = legacy.Compare(hash, password)
+	}
+	return err
+}
+
+// NeedsRehash delivers true for every hash not made by Current with its parameters
+func (m *MigratingEncrypter) NeedsRehash(hash string) bool {
+	return m.Current.NeedsRehash(hash)
+}
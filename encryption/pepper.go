@@ -0,0 +1,105 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownPepper delivered when a hash names a pepper key ID that is not configured
+var ErrUnknownPepper = errors.New("Unknown pepper key ID")
+
+const pepperPrefix = "$pepper$"
+
+// PepperedEncrypter applies an HMAC-SHA256 pepper before hashing with Encrypter.
+// Peppers live outside the user store, keyed by ID; the ID used is stored in the
+// hash as "$pepper$<id><inner hash>" so peppers can be rotated by changing
+// CurrentKeyID while keeping the old ones around for verification
+type PepperedEncrypter struct {
+	Encrypter    Encrypter
+	Peppers      map[string][]byte
+	CurrentKeyID string
+}
+
+func (p *PepperedEncrypter) Encrypt(password string) (string, error) {
+	pepper, ok := p.Peppers[p.CurrentKeyID]
+	if !ok {
+		return "", ErrUnknownPepper
+	}
+
+	hash, err := p.Encrypter.Encrypt(applyPepper(pepper, password))
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + p.CurrentKeyID + hash, nil
+}
+
+// Compare delivers nil when password matches the hash. Hashes made before peppering
+// was enabled are compared as they are
+func (p *PepperedEncrypter) Compare(hash string, password string) error {
+	keyID, inner, peppered := splitPepperedHash(hash)
+	if !peppered {
+		return p.Encrypter.Compare(hash, password)
+	}
+
+	pepper, ok := p.Peppers[keyID]
+	if !ok {
+		return ErrUnknownPepper
+	}
+	return p.Encrypter.Compare(inner, applyPepper(pepper, password))
+}
+
+// NeedsRehash delivers true for unpeppered hashes, hashes peppered with an old
+// key and hashes the wrapped Encrypter considers outdated
+func (p *PepperedEncrypter) NeedsRehash(hash string) bool {
+	keyID, inner, peppered := splitPepperedHash(hash)
+	return !peppered || keyID != p.CurrentKeyID || p.Encrypter.NeedsRehash(inner)
+}
+
+// ParsePeppers reads peppers in the "id:base64,id:base64" format
+func ParsePeppers(spec string) (map[string][]byte, error) {
+	peppers := map[string][]byte{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || strings.Contains(parts[0], "$") {
+			return nil, fmt.Errorf("invalid pepper entry %q", entry)
+		}
+
+		pepper, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(pepper) == 0 {
+			return nil, fmt.Errorf("invalid pepper for key ID %q", parts[0])
+		}
+		peppers[parts[0]] = pepper
+	}
+
+	return peppers, nil
+}
+
+// applyPepper delivers base64 so the result stays below bcrypt's 72 byte limit
+func applyPepper(pepper []byte, password string) string {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func splitPepperedHash(hash string) (keyID string, inner string, peppered bool) {
+	if !strings.HasPrefix(hash, pepperPrefix) {
+		return "", hash, false
+	}
+
+	rest := hash[len(pepperPrefix):]
+	end := strings.Index(rest, "$")
+	if end <= 0 {
+		return "", hash, false
+	}
+	return rest[:end], rest[end:], true
+}
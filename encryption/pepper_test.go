@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPepperedEncrypter(t *testing.T) {
+	inner := &Argon2idEncrypter{Memory: 8, Time: 1, Parallelism: 1}
+	peppers := map[string][]byte{"old": []byte("old-pepper"), "new": []byte("new-pepper")}
+
+	t.Run("Embeds the current key ID in the hash", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "new"}
+
+		hash, err := sut.Encrypt("test")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		if !strings.HasPrefix(hash, "$pepper$new$argon2id$") {
+			t.Errorf("got %q, want peppered argon2id hash", hash)
+		}
+	})
+
+	t.Run("Does not verify without the pepper", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "new"}
+		hash, _ := sut.Encrypt("test")
+		_, innerHash, _ := splitPepperedHash(hash)
+
+		if err := inner.Compare(innerHash, "test"); err == nil {
+			t.Errorf("got nil, want failure comparing without pepper")
+		}
+	})
+
+	t.Run("Verifies hashes made with rotated out peppers", func(t *testing.T) {
+		old := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "old"}
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "new"}
+		hash, _ := old.Encrypt("test")
+
+		if err := sut.Compare(hash, "test"); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+
+		if err := sut.Compare(hash, "wrong"); err == nil {
+			t.Errorf("got nil, want failure")
+		}
+
+		assertNeedsRehash(t, sut, hash, true)
+	})
+
+	t.Run("Verifies unpeppered hashes and asks for a rehash", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "new"}
+		hash, _ := inner.Encrypt("test")
+
+		if err := sut.Compare(hash, "test"); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+
+		assertNeedsRehash(t, sut, hash, true)
+	})
+
+	t.Run("Does not need rehash for current pepper and parameters", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "new"}
+		hash, _ := sut.Encrypt("test")
+
+		assertNeedsRehash(t, sut, hash, false)
+	})
+
+	t.Run("Delivers ErrUnknownPepper for missing key IDs", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: inner, Peppers: peppers, CurrentKeyID: "missing"}
+
+		if _, err := sut.Encrypt("test"); err != ErrUnknownPepper {
+			t.Errorf("got %v, want %v", err, ErrUnknownPepper)
+		}
+
+		if err := sut.Compare("$pepper$missing$argon2id$v=19$m=8,t=1,p=1$c2FsdA$a2V5", "test"); err != ErrUnknownPepper {
+			t.Errorf("got %v, want %v", err, ErrUnknownPepper)
+		}
+	})
+
+	t.Run("Keeps bcrypt input under its 72 byte limit", func(t *testing.T) {
+		sut := &PepperedEncrypter{Encrypter: &BCryptEncrypter{Cost: 4}, Peppers: peppers, CurrentKeyID: "new"}
+		long := strings.Repeat("a", 100)
+		hash, _ := sut.Encrypt(long)
+
+		if err := sut.Compare(hash, long[:99]+"b"); err == nil {
+			t.Errorf("got nil, want failure for password differing past 72 bytes")
+		}
+	})
+}
+
+func TestParsePeppers(t *testing.T) {
+	t.Run("Delivers decoded peppers by key ID", func(t *testing.T) {
+		got, err := ParsePeppers("k1:b25l, k2:dHdv")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		want := map[string][]byte{"k1": []byte("one"), "k2": []byte("two")}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers error on malformed entries", func(t *testing.T) {
+		for _, spec := range []string{"k1", ":b25l", "k1:not base64", "k$1:b25l", "k1:"} {
+			if _, err := ParsePeppers(spec); err == nil {
+				t.Errorf("got nil for %q, want failure", spec)
+			}
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package food
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // ErrMissingParam error struct for displaying missing param error with specified param
@@ -16,33 +19,111 @@ func (e *ErrMissingParam) Error() string {
 // ErrInternalServer constant for error message
 const ErrInternalServer = "Internal server error"
 
-// Food struct type
+// ErrNotFound constant for error message
+const ErrNotFound = "Food not found"
+
+// ErrEmptyPatch constant for error message
+const ErrEmptyPatch = "Empty patch, give at least one field to change"
+
+// ErrFoodNotFound delivered by stores when no food has the requested ID
+var ErrFoodNotFound = errors.New(ErrNotFound)
+
+// Food struct type, ID is assigned by the server. Nutrients are declared per Basis,
+// macronutrients in grams and sodium in milligrams, micronutrients are keyed by
+// name, e.g. "Vitamin C". Density in g/ml converts between mass and volume. Owner
+// is the user who created it and is kept out of responses
 type Food struct {
-	Name     string
-	Calories int
+	ID             string
+	Name           string
+	Basis          Basis
+	Calories       int
+	Protein        float64
+	Carbohydrates  float64
+	Fat            float64
+	Fiber          float64
+	Sugar          float64
+	Sodium         float64
+	Micronutrients map[string]Nutrient
+	Density        float64
+	Servings       []Serving
+	Owner          string `json:"-"`
 }
 
-// FoodsServer struct to use FoodsStore
+// FoodPatch struct type, only the given fields are changed. Micronutrients and
+// servings given replace all the previous ones
+type FoodPatch struct {
+	Name           *string
+	Basis          *Basis
+	Calories       *int
+	Protein        *float64
+	Carbohydrates  *float64
+	Fat            *float64
+	Fiber          *float64
+	Sugar          *float64
+	Sodium         *float64
+	Micronutrients map[string]Nutrient
+	Density        *float64
+	Servings       []Serving
+}
+
+// FoodsServer struct to use FoodsStore, Owner identifies who is creating foods. Index
+// serves /foods/search, it should be kept in sync by wrapping Store in an IndexedFoodsStore
 type FoodsServer struct {
 	Store FoodsStore
+	Owner func(req *http.Request) string
+	Index *SearchIndex
 }
 
-// FoodServer handles requests for foods
+// FoodServer handles requests for foods, on /foods, /foods/search and /foods/{id}
 func (f *FoodsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.Method == http.MethodGet {
-		handleGetFoods(f, w, req)
-	} else {
-		handlePostFood(f, w, req)
+	if req.URL.Path == "/foods" {
+		switch req.Method {
+		case http.MethodGet:
+			handleGetFoods(f, w, req)
+		case http.MethodPost:
+			handlePostFood(f, w, req)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
 	}
-}
 
-func handleGetFoods(f *FoodsServer, w http.ResponseWriter, req *http.Request) {
-	foods, err := f.Store.GetFoods()
+	if req.URL.Path == "/foods/search" {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handleSearchFoods(f, w, req)
+		return
+	}
 
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
-	} else {
-		respondWithSuccess(w, http.StatusOK, foods)
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/foods/"), "/")
+	id := parts[0]
+	if !strings.HasPrefix(req.URL.Path, "/foods/") || id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "nutrients") {
+		respondWithError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handleFoodNutrients(f, w, req, id)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		handleGetFood(f, w, id)
+	case http.MethodPut:
+		handlePutFood(f, w, req, id)
+	case http.MethodPatch:
+		handlePatchFood(f, w, req, id)
+	case http.MethodDelete:
+		handleDeleteFood(f, w, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
@@ -50,18 +131,27 @@ func handlePostFood(f *FoodsServer, w http.ResponseWriter, req *http.Request) {
 	var foodParam Food
 	json.NewDecoder(req.Body).Decode(&foodParam)
 
-	if foodParam.Name == "" {
-		err := ErrMissingParam("Name")
-		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	if missingParam := checkMissingParams(foodParam); missingParam != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParam.Error())
 		return
 	}
 
-	if foodParam.Calories == 0 {
-		err := ErrMissingParam("Calories")
-		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	if invalid := validateFood(&foodParam); invalid != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, invalid)
 		return
 	}
 
+	id, err := newFoodID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+	foodParam.ID = id
+
+	if f.Owner != nil {
+		foodParam.Owner = f.Owner(req)
+	}
+
 	food, err := f.Store.PostFood(foodParam)
 
 	if err != nil {
@@ -71,6 +161,178 @@ func handlePostFood(f *FoodsServer, w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func handleGetFood(f *FoodsServer, w http.ResponseWriter, id string) {
+	food, err := f.Store.GetFood(id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	respondWithSuccess(w, http.StatusOK, food)
+}
+
+// handlePutFood replaces every field of the food, keeping its ID and owner
+func handlePutFood(f *FoodsServer, w http.ResponseWriter, req *http.Request, id string) {
+	var foodParam Food
+	json.NewDecoder(req.Body).Decode(&foodParam)
+
+	if missingParam := checkMissingParams(foodParam); missingParam != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParam.Error())
+		return
+	}
+
+	if invalid := validateFood(&foodParam); invalid != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, invalid)
+		return
+	}
+
+	current, err := f.Store.GetFood(id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	foodParam.ID = current.ID
+	foodParam.Owner = current.Owner
+	updateFood(f, w, foodParam)
+}
+
+// handlePatchFood changes only the fields given, which may not be emptied
+func handlePatchFood(f *FoodsServer, w http.ResponseWriter, req *http.Request, id string) {
+	var patch FoodPatch
+	json.NewDecoder(req.Body).Decode(&patch)
+
+	if patch.empty() {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrEmptyPatch)
+		return
+	}
+
+	current, err := f.Store.GetFood(id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	if patch.Name != nil {
+		current.Name = *patch.Name
+	}
+	if patch.Calories != nil {
+		current.Calories = *patch.Calories
+	}
+	patchAmount(&current.Protein, patch.Protein)
+	patchAmount(&current.Carbohydrates, patch.Carbohydrates)
+	patchAmount(&current.Fat, patch.Fat)
+	patchAmount(&current.Fiber, patch.Fiber)
+	patchAmount(&current.Sugar, patch.Sugar)
+	patchAmount(&current.Sodium, patch.Sodium)
+	if patch.Micronutrients != nil {
+		current.Micronutrients = patch.Micronutrients
+	}
+	if patch.Basis != nil {
+		current.Basis = *patch.Basis
+	}
+	patchAmount(&current.Density, patch.Density)
+	if patch.Servings != nil {
+		current.Servings = patch.Servings
+	}
+
+	if missingParam := checkMissingParams(current); missingParam != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParam.Error())
+		return
+	}
+
+	if invalid := validateFood(&current); invalid != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, invalid)
+		return
+	}
+
+	updateFood(f, w, current)
+}
+
+func (p FoodPatch) empty() bool {
+	amounts := []*float64{p.Protein, p.Carbohydrates, p.Fat, p.Fiber, p.Sugar, p.Sodium}
+	for _, amount := range amounts {
+		if amount != nil {
+			return false
+		}
+	}
+	return p.Name == nil && p.Basis == nil && p.Calories == nil && p.Micronutrients == nil && p.Density == nil && p.Servings == nil
+}
+
+func patchAmount(amount *float64, patched *float64) {
+	if patched != nil {
+		*amount = *patched
+	}
+}
+
+func updateFood(f *FoodsServer, w http.ResponseWriter, food Food) {
+	updated, err := f.Store.UpdateFood(food)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	respondWithSuccess(w, http.StatusOK, updated)
+}
+
+func handleDeleteFood(f *FoodsServer, w http.ResponseWriter, id string) {
+	if err := f.Store.DeleteFood(id); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportUserData delivers the foods created by owner
+func (f *FoodsServer) ExportUserData(owner string) (interface{}, error) {
+	return f.Store.FoodsOwnedBy(owner)
+}
+
+// TransferUserData hands the foods created by from over to to
+func (f *FoodsServer) TransferUserData(from string, to string) error {
+	return f.Store.TransferFoods(from, to)
+}
+
+// PurgeUserData deletes the foods created by owner
+func (f *FoodsServer) PurgeUserData(owner string) error {
+	return f.Store.DeleteFoodsOwnedBy(owner)
+}
+
+// validateFood delivers why the food is invalid, or "" when it is fine
+func validateFood(food *Food) string {
+	if invalid := validateNutrients(food); invalid != "" {
+		return invalid
+	}
+	return validateServings(food)
+}
+
+func checkMissingParams(food Food) ErrMissingParam {
+	if food.Name == "" {
+		return ErrMissingParam("Name")
+	}
+	if food.Calories == 0 {
+		return ErrMissingParam("Calories")
+	}
+	return ""
+}
+
+// newFoodID generates a random (version 4) UUID
+func newFoodID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+func respondWithStoreError(w http.ResponseWriter, err error) {
+	if err == ErrFoodNotFound {
+		respondWithError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+}
+
 func respondWithError(w http.ResponseWriter, status int, err string) {
 	w.WriteHeader(status)
 	fmt.Fprint(w, err)
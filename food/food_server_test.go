@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -20,29 +21,93 @@ func (f *FoodsStoreStub) GetFoods() ([]Food, error) {
 	return f.foods, nil
 }
 
+func (f *FoodsStoreStub) SearchFoods(query FoodQuery) (FoodPage, error) {
+	return FoodPage{Foods: f.foods, Total: len(f.foods)}, nil
+}
+
 func (f *FoodsStoreStub) PostFood(food Food) (Food, error) {
 	return food, nil
 }
 
+func (f *FoodsStoreStub) GetFood(id string) (Food, error) {
+	return Food{}, ErrFoodNotFound
+}
+
+func (f *FoodsStoreStub) UpdateFood(food Food) (Food, error) {
+	return food, nil
+}
+
+func (f *FoodsStoreStub) DeleteFood(id string) error {
+	return nil
+}
+
+func (f *FoodsStoreStub) FoodsOwnedBy(owner string) ([]Food, error) {
+	return f.foods, nil
+}
+
+func (f *FoodsStoreStub) TransferFoods(from string, to string) error {
+	return nil
+}
+
+func (f *FoodsStoreStub) DeleteFoodsOwnedBy(owner string) error {
+	return nil
+}
+
 type FailureStubStore struct{}
 
 func (f *FailureStubStore) GetFoods() ([]Food, error) {
 	return nil, errors.New(ErrInternalServer)
 }
 
+func (f *FailureStubStore) SearchFoods(query FoodQuery) (FoodPage, error) {
+	return FoodPage{}, errors.New(ErrInternalServer)
+}
+
 func (f *FailureStubStore) PostFood(food Food) (Food, error) {
 	return Food{}, errors.New(ErrInternalServer)
 }
 
+func (f *FailureStubStore) GetFood(id string) (Food, error) {
+	return Food{}, errors.New(ErrInternalServer)
+}
+
+func (f *FailureStubStore) UpdateFood(food Food) (Food, error) {
+	return Food{}, errors.New(ErrInternalServer)
+}
+
+func (f *FailureStubStore) DeleteFood(id string) error {
+	return errors.New(ErrInternalServer)
+}
+
+func (f *FailureStubStore) FoodsOwnedBy(owner string) ([]Food, error) {
+	return nil, errors.New(ErrInternalServer)
+}
+
+func (f *FailureStubStore) TransferFoods(from string, to string) error {
+	return errors.New(ErrInternalServer)
+}
+
+func (f *FailureStubStore) DeleteFoodsOwnedBy(owner string) error {
+	return errors.New(ErrInternalServer)
+}
+
 type FoodsStoreSpy struct {
 	calls          int
 	postFoodParams Food
+	ownerParam     string
+	transferParams [2]string
+	query          FoodQuery
 }
 
 func (f *FoodsStoreSpy) GetFoods() ([]Food, error) {
 	return nil, nil
 }
 
+func (f *FoodsStoreSpy) SearchFoods(query FoodQuery) (FoodPage, error) {
+	f.query = query
+	return FoodPage{}, nil
+}
+
 func (f *FoodsStoreSpy) PostFood(food Food) (Food, error) {
 	f.calls++
 	f.postFoodParams = food
@@ -50,6 +115,35 @@ func (f *FoodsStoreSpy) PostFood(food Food) (Food, error) {
 	return Food{}, nil
 }
 
+func (f *FoodsStoreSpy) GetFood(id string) (Food, error) {
+	return Food{}, ErrFoodNotFound
+}
+
+func (f *FoodsStoreSpy) UpdateFood(food Food) (Food, error) {
+	f.calls++
+	return food, nil
+}
+
+func (f *FoodsStoreSpy) DeleteFood(id string) error {
+	f.calls++
+	return nil
+}
+
+func (f *FoodsStoreSpy) FoodsOwnedBy(owner string) ([]Food, error) {
+	f.ownerParam = owner
+	return nil, nil
+}
+
+func (f *FoodsStoreSpy) TransferFoods(from string, to string) error {
+	f.transferParams = [2]string{from, to}
+	return nil
+}
+
+func (f *FoodsStoreSpy) DeleteFoodsOwnedBy(owner string) error {
+	f.ownerParam = owner
+	return nil
+}
+
 func TestGetFoods(t *testing.T) {
 	server := &FoodsServer{}
 
@@ -59,7 +153,7 @@ func TestGetFoods(t *testing.T) {
 	}
 
 	t.Run("returns multiple Foods in store", func(t *testing.T) {
-		wantedFoods := []Food{{"food name 1", 300}, {"food name 2", 400}}
+		wantedFoods := []Food{{Name: "food name 1", Calories: 300}, {Name: "food name 2", Calories: 400}}
 		server.Store = &FoodsStoreStub{wantedFoods}
 		response := httptest.NewRecorder()
 
@@ -107,14 +201,16 @@ func TestPostFood(t *testing.T) {
 	t.Run("Delivers correct params to storage", func(t *testing.T) {
 		spy := &FoodsStoreSpy{}
 		server.Store = spy
-		want := Food{"test", 111}
+		want := Food{Name: "test", Calories: 111}
 		body := fmt.Sprintf(`{"name": %q,"calories":%d}`, want.Name, want.Calories)
 
 		server.ServeHTTP(httptest.NewRecorder(), makePostFoodRequest(body))
 
 		assertCallsCount(t, spy.calls, 1)
 
-		if spy.postFoodParams != want {
+		want.ID = spy.postFoodParams.ID
+		want.Basis = BasisMass
+		if !reflect.DeepEqual(spy.postFoodParams, want) {
 			t.Errorf("got %v, want %v", spy.postFoodParams, want)
 		}
 	})
@@ -166,7 +262,7 @@ func TestPostFood(t *testing.T) {
 		server.Store = &FoodsStoreStub{}
 		response := httptest.NewRecorder()
 
-		want := Food{"test", 111}
+		want := Food{Name: "test", Calories: 111}
 		body := fmt.Sprintf(`{"name":%q,"calories":%d}`, want.Name, want.Calories)
 
 		server.ServeHTTP(response, makePostFoodRequest(body))
@@ -175,11 +271,205 @@ func TestPostFood(t *testing.T) {
 		json.NewDecoder(response.Body).Decode(&got)
 		assertStatus(t, response.Code, http.StatusCreated)
 
-		if got != want {
+		want.ID = got.ID
+		want.Basis = BasisMass
+		if !reflect.DeepEqual(got, want) {
 			t.Errorf("got %v, want %v", got, want)
 		}
 	})
 
+	t.Run("Assigns a new ID to every food, ignoring the given one", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+		server.Store = spy
+		body := `{"id": "chosen-id", "name": "test","calories":111}`
+
+		server.ServeHTTP(httptest.NewRecorder(), makePostFoodRequest(body))
+		first := spy.postFoodParams.ID
+		server.ServeHTTP(httptest.NewRecorder(), makePostFoodRequest(body))
+
+		uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+		if !uuid.MatchString(first) || first == spy.postFoodParams.ID {
+			t.Errorf("got %q and %q, want distinct random UUIDs", first, spy.postFoodParams.ID)
+		}
+	})
+
+	t.Run("Stores the creator as owner without responding with it", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+		server := &FoodsServer{Store: spy, Owner: func(req *http.Request) string { return "any@mail.com" }}
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, makePostFoodRequest(`{"name": "test","calories":111,"owner":"other@mail.com"}`))
+
+		if spy.postFoodParams.Owner != "any@mail.com" {
+			t.Errorf("got %q, want %q", spy.postFoodParams.Owner, "any@mail.com")
+		}
+
+		if strings.Contains(response.Body.String(), "mail.com") {
+			t.Errorf("got %s, want owner left out", response.Body.String())
+		}
+	})
+}
+
+func TestFoodByID(t *testing.T) {
+	makeSUT := func() (*FoodsServer, *InMemoryFoodsStore) {
+		store := &InMemoryFoodsStore{Foods: []Food{
+			{ID: "any-id", Name: "food", Calories: 100, Owner: "any@mail.com"},
+			{ID: "other-id", Name: "other food", Calories: 200},
+		}}
+		return &FoodsServer{Store: store}, store
+	}
+
+	t.Run("Delivers the food with the ID", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		response := makeFoodRequest(server, http.MethodGet, "/foods/any-id", "")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFoodBody(t, response.Body, Food{ID: "any-id", Name: "food", Calories: 100})
+	})
+
+	t.Run("Delivers 404 for unknown IDs on every method", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			response := makeFoodRequest(server, method, "/foods/unknown-id", `{"name": "food","calories":1}`)
+
+			assertStatus(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrNotFound)
+		}
+	})
+
+	t.Run("Delivers 404 for nested paths", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		for _, path := range []string{"/foods/any-id/more", "/foods/any-id/nutrients/more", "/foods/"} {
+			response := makeFoodRequest(server, http.MethodGet, path, "")
+
+			assertStatus(t, response.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Replaces every field on put, keeping ID and owner", func(t *testing.T) {
+		server, store := makeSUT()
+
+		response := makeFoodRequest(server, http.MethodPut, "/foods/any-id", `{"id": "other-id", "name": "renamed","calories":150}`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFoodBody(t, response.Body, Food{ID: "any-id", Name: "renamed", Basis: BasisMass, Calories: 150})
+		assertStoredFood(t, store, Food{ID: "any-id", Name: "renamed", Basis: BasisMass, Calories: 150, Owner: "any@mail.com"})
+	})
+
+	t.Run("Delivers missing params on incomplete put", func(t *testing.T) {
+		server, store := makeSUT()
+
+		response := makeFoodRequest(server, http.MethodPut, "/foods/any-id", `{"name": "renamed"}`)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertMissingParam(t, response.Body.String(), "Calories")
+		assertStoredFood(t, store, Food{ID: "any-id", Name: "food", Calories: 100, Owner: "any@mail.com"})
+	})
+
+	t.Run("Changes only the given fields on patch", func(t *testing.T) {
+		server, store := makeSUT()
+
+		response := makeFoodRequest(server, http.MethodPatch, "/foods/any-id", `{"calories":120}`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertStoredFood(t, store, Food{ID: "any-id", Name: "food", Basis: BasisMass, Calories: 120, Owner: "any@mail.com"})
+	})
+
+	t.Run("Delivers 422 status code on empty patch or emptied fields", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		empty := makeFoodRequest(server, http.MethodPatch, "/foods/any-id", `{}`)
+		emptied := makeFoodRequest(server, http.MethodPatch, "/foods/any-id", `{"name": ""}`)
+
+		assertStatus(t, empty.Code, http.StatusUnprocessableEntity)
+		assertError(t, empty.Body.String(), ErrEmptyPatch)
+		assertStatus(t, emptied.Code, http.StatusUnprocessableEntity)
+		assertMissingParam(t, emptied.Body.String(), "Name")
+	})
+
+	t.Run("Deletes the food", func(t *testing.T) {
+		server, store := makeSUT()
+
+		response := makeFoodRequest(server, http.MethodDelete, "/foods/any-id", "")
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		if _, err := store.GetFood("any-id"); err != ErrFoodNotFound {
+			t.Errorf("got %v, want %v", err, ErrFoodNotFound)
+		}
+	})
+
+	t.Run("Delivers 500 status code on storage error", func(t *testing.T) {
+		server := &FoodsServer{Store: &FailureStubStore{}}
+
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			response := makeFoodRequest(server, method, "/foods/any-id", `{"name": "food","calories":1}`)
+
+			assertStatus(t, response.Code, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("Delivers 405 status code on unsupported methods", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		assertStatus(t, makeFoodRequest(server, http.MethodPost, "/foods/any-id", "").Code, http.StatusMethodNotAllowed)
+		assertStatus(t, makeFoodRequest(server, http.MethodDelete, "/foods", "").Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestFoodsPersonalData(t *testing.T) {
+	t.Run("Delegates export, transfer and purge to the store", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+		server := &FoodsServer{Store: spy}
+
+		server.ExportUserData("any@mail.com")
+		assertOwner(t, spy.ownerParam, "any@mail.com")
+
+		server.PurgeUserData("other@mail.com")
+		assertOwner(t, spy.ownerParam, "other@mail.com")
+
+		server.TransferUserData("any@mail.com", "new@mail.com")
+		if spy.transferParams != [2]string{"any@mail.com", "new@mail.com"} {
+			t.Errorf("got %v, want transfer to new@mail.com", spy.transferParams)
+		}
+	})
+}
+
+func makeFoodRequest(server *FoodsServer, method string, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, strings.NewReader(body))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	return response
+}
+
+func assertFoodBody(t *testing.T, body *bytes.Buffer, want Food) {
+	t.Helper()
+	var got Food
+	if err := json.NewDecoder(body).Decode(&got); err != nil {
+		t.Fatalf("Unable to decode: error %q", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func assertStoredFood(t *testing.T, store *InMemoryFoodsStore, want Food) {
+	t.Helper()
+	got, err := store.GetFood(want.ID)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v and %v, want %v", got, err, want)
+	}
+}
+
+func assertOwner(t *testing.T, got string, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
 }
 
 func assertCallsCount(t *testing.T, got int, want int) {
@@ -207,7 +497,7 @@ func assertJSONBody(t *testing.T, body *bytes.Buffer, want []Food) {
 	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("got %q, want %q", got, want)
+		t.Errorf("got %v, want %v", got, want)
 	}
 }
 
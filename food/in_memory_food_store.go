@@ -1,23 +1,146 @@
 package food
 
+import (
+	"sort"
+	"sync"
+)
+
 // FoodsStore interface for Food storage operations
 type FoodsStore interface {
 	GetFoods() ([]Food, error)
+	SearchFoods(query FoodQuery) (FoodPage, error)
 	PostFood(food Food) (Food, error)
+	GetFood(id string) (Food, error)
+	UpdateFood(food Food) (Food, error)
+	DeleteFood(id string) error
+	FoodsOwnedBy(owner string) ([]Food, error)
+	TransferFoods(from string, to string) error
+	DeleteFoodsOwnedBy(owner string) error
 }
 
-// InMemoryFoodsStore in memory store for testing
+// InMemoryFoodsStore in memory store for testing, safe for concurrent use
 type InMemoryFoodsStore struct {
+	mu    sync.Mutex
 	Foods []Food
 }
 
 // GetFoods returns Foods
 func (f *InMemoryFoodsStore) GetFoods() ([]Food, error) {
-	return f.Foods, nil
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Food{}, f.Foods...), nil
+}
+
+// SearchFoods returns the page of Foods matching query
+func (f *InMemoryFoodsStore) SearchFoods(query FoodQuery) (FoodPage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	matching := []Food{}
+	for _, food := range f.Foods {
+		if query.matches(food) {
+			matching = append(matching, food)
+		}
+	}
+
+	sort.Slice(matching, func(a, b int) bool {
+		return query.before(query.cursorOf(matching[a]), query.cursorOf(matching[b]))
+	})
+
+	page := FoodPage{Foods: []Food{}, Total: len(matching)}
+	for _, food := range matching {
+		if query.After != nil && !query.before(*query.After, query.cursorOf(food)) {
+			continue
+		}
+		if query.Limit > 0 && len(page.Foods) == query.Limit {
+			page.More = true
+			break
+		}
+		page.Foods = append(page.Foods, food)
+	}
+	return page, nil
 }
 
 // PostFood saves food
 func (f *InMemoryFoodsStore) PostFood(food Food) (Food, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.Foods = append(f.Foods, food)
 	return food, nil
 }
+
+// GetFood returns the Food with id
+func (f *InMemoryFoodsStore) GetFood(id string) (Food, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, food := range f.Foods {
+		if food.ID == id {
+			return food, nil
+		}
+	}
+	return Food{}, ErrFoodNotFound
+}
+
+// UpdateFood replaces the Food with the same ID
+func (f *InMemoryFoodsStore) UpdateFood(food Food) (Food, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for index := range f.Foods {
+		if f.Foods[index].ID == food.ID {
+			f.Foods[index] = food
+			return food, nil
+		}
+	}
+	return Food{}, ErrFoodNotFound
+}
+
+// DeleteFood removes the Food with id
+func (f *InMemoryFoodsStore) DeleteFood(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for index := range f.Foods {
+		if f.Foods[index].ID == id {
+			f.Foods = append(f.Foods[:index], f.Foods[index+1:]...)
+			return nil
+		}
+	}
+	return ErrFoodNotFound
+}
+
+// FoodsOwnedBy returns Foods created by owner
+func (f *InMemoryFoodsStore) FoodsOwnedBy(owner string) ([]Food, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	foods := []Food{}
+	for _, food := range f.Foods {
+		if food.Owner == owner {
+			foods = append(foods, food)
+		}
+	}
+	return foods, nil
+}
+
+// TransferFoods changes the owner of foods created by from
+func (f *InMemoryFoodsStore) TransferFoods(from string, to string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for index := range f.Foods {
+		if f.Foods[index].Owner == from {
+			f.Foods[index].Owner = to
+		}
+	}
+	return nil
+}
+
+// DeleteFoodsOwnedBy removes Foods created by owner
+func (f *InMemoryFoodsStore) DeleteFoodsOwnedBy(owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kept := f.Foods[:0]
+	for _, food := range f.Foods {
+		if food.Owner != owner {
+			kept = append(kept, food)
+		}
+	}
+	f.Foods = kept
+	return nil
+}
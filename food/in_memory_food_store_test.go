@@ -7,24 +7,76 @@ import (
 
 func TestInMemoryFoodStore(t *testing.T) {
 	t.Run("Delivers empty slice of foods on empty store", func(t *testing.T) {
-		store := InMemoryFoodsStore{[]Food{}}
-		assertFoods(t, store, []Food{})
+		store := InMemoryFoodsStore{Foods: []Food{}}
+		assertFoods(t, &store, []Food{})
 	})
 
 	t.Run("Delivers slice of foods with inserted food", func(t *testing.T) {
-		food := Food{"food", 1234}
-		food2 := Food{"food 2", 4321}
+		food := Food{Name: "food", Calories: 1234}
+		food2 := Food{Name: "food 2", Calories: 4321}
 		store := InMemoryFoodsStore{}
 
 		store.PostFood(food)
-		assertFoods(t, store, []Food{food})
+		assertFoods(t, &store, []Food{food})
 
 		store.PostFood(food2)
-		assertFoods(t, store, []Food{food, food2})
+		assertFoods(t, &store, []Food{food, food2})
+	})
+
+	t.Run("Finds, transfers and deletes foods by owner", func(t *testing.T) {
+		mine := Food{Name: "food", Calories: 1234, Owner: "any@mail.com"}
+		other := Food{Name: "food 2", Calories: 4321, Owner: "other@mail.com"}
+		store := InMemoryFoodsStore{Foods: []Food{mine, other}}
+
+		owned, _ := store.FoodsOwnedBy("any@mail.com")
+		if !reflect.DeepEqual(owned, []Food{mine}) {
+			t.Errorf("got %v, want %v", owned, []Food{mine})
+		}
+
+		store.TransferFoods("any@mail.com", "new@mail.com")
+		mine.Owner = "new@mail.com"
+		assertFoods(t, &store, []Food{mine, other})
+
+		store.DeleteFoodsOwnedBy("new@mail.com")
+		assertFoods(t, &store, []Food{other})
+	})
+}
+
+func TestInMemoryFoodStoreByID(t *testing.T) {
+	t.Run("Finds, updates and deletes foods by ID", func(t *testing.T) {
+		food := Food{ID: "any-id", Name: "food", Calories: 1234}
+		other := Food{ID: "other-id", Name: "food 2", Calories: 4321}
+		store := InMemoryFoodsStore{Foods: []Food{food, other}}
+
+		got, err := store.GetFood("other-id")
+		if err != nil || !reflect.DeepEqual(got, other) {
+			t.Errorf("got %v and %v, want %v", got, err, other)
+		}
+
+		food.Calories = 1000
+		store.UpdateFood(food)
+		assertFoods(t, &store, []Food{food, other})
+
+		store.DeleteFood("any-id")
+		assertFoods(t, &store, []Food{other})
+	})
+
+	t.Run("Delivers ErrFoodNotFound for unknown IDs", func(t *testing.T) {
+		store := InMemoryFoodsStore{Foods: []Food{}}
+
+		_, getErr := store.GetFood("any-id")
+		_, updateErr := store.UpdateFood(Food{ID: "any-id"})
+		deleteErr := store.DeleteFood("any-id")
+
+		for _, err := range []error{getErr, updateErr, deleteErr} {
+			if err != ErrFoodNotFound {
+				t.Errorf("got %v, want %v", err, ErrFoodNotFound)
+			}
+		}
 	})
 }
 
-func assertFoods(t *testing.T, store InMemoryFoodsStore, want []Food) {
+func assertFoods(t *testing.T, store *InMemoryFoodsStore, want []Food) {
 	t.Helper()
 	got, _ := store.GetFoods()
 	if !reflect.DeepEqual(got, want) {
@@ -0,0 +1,130 @@
+package food
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrInvalidParam error struct for displaying invalid param error with specified param
+type ErrInvalidParam string
+
+func (e *ErrInvalidParam) Error() string {
+	return string("Invalid parameter: " + *e)
+}
+
+// ErrInconsistentCalories constant for error message
+const ErrInconsistentCalories = "Macronutrients don't add up to the calories"
+
+// Energy per gram of each macronutrient (Atwater general factors)
+const (
+	caloriesPerGramProtein       = 4
+	caloriesPerGramCarbohydrates = 4
+	caloriesPerGramFat           = 9
+)
+
+// CalorieTolerance is how far calories may stray from what the macros add up to,
+// as a fraction of the calories. Labels round, count fiber differently and leave
+// out alcohol, so only gross mistakes are refused
+const CalorieTolerance = 0.2
+
+// minCalorieTolerance keeps the tolerance meaningful for low calorie foods
+const minCalorieTolerance = 10
+
+// Nutrient struct type, an amount in one of the supported units
+type Nutrient struct {
+	Amount float64
+	Unit   string
+}
+
+// Supported micronutrient units
+const (
+	UnitGram              = "g"
+	UnitMilligram         = "mg"
+	UnitMicrogram         = "µg"
+	UnitInternationalUnit = "IU"
+)
+
+// unitAliases spellings accepted for supported units
+var unitAliases = map[string]string{
+	"mcg": UnitMicrogram,
+	"ug":  UnitMicrogram,
+	"μg":  UnitMicrogram,
+}
+
+// validateNutrients delivers why the food's nutrients are invalid, or "" when they
+// are fine, normalizing micronutrient units. Macros all zero are taken as unknown
+func validateNutrients(food *Food) string {
+	macros := []struct {
+		name   string
+		amount float64
+	}{
+		{"Protein", food.Protein},
+		{"Carbohydrates", food.Carbohydrates},
+		{"Fat", food.Fat},
+		{"Fiber", food.Fiber},
+		{"Sugar", food.Sugar},
+		{"Sodium", food.Sodium},
+	}
+
+	if food.Calories < 0 {
+		return invalidParam("Calories")
+	}
+
+	for _, macro := range macros {
+		if !validAmount(macro.amount) {
+			return invalidParam(macro.name)
+		}
+	}
+
+	if food.Fiber > food.Carbohydrates {
+		return invalidParam("Fiber")
+	}
+
+	if food.Sugar > food.Carbohydrates {
+		return invalidParam("Sugar")
+	}
+
+	names := make([]string, 0, len(food.Micronutrients))
+	for name := range food.Micronutrients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nutrient := food.Micronutrients[name]
+		if alias, ok := unitAliases[nutrient.Unit]; ok {
+			nutrient.Unit = alias
+			food.Micronutrients[name] = nutrient
+		}
+
+		if name == "" || !validAmount(nutrient.Amount) || !validUnit(nutrient.Unit) {
+			return invalidParam("Micronutrients." + name)
+		}
+	}
+
+	if food.Protein == 0 && food.Carbohydrates == 0 && food.Fat == 0 {
+		return ""
+	}
+
+	estimated := caloriesPerGramProtein*food.Protein + caloriesPerGramCarbohydrates*food.Carbohydrates + caloriesPerGramFat*food.Fat
+	tolerance := math.Max(CalorieTolerance*float64(food.Calories), minCalorieTolerance)
+	if math.Abs(estimated-float64(food.Calories)) > tolerance {
+		return fmt.Sprintf("%s (%.0f kcal)", ErrInconsistentCalories, estimated)
+	}
+
+	return ""
+}
+
+func validAmount(amount float64) bool {
+	return amount >= 0 && !math.IsInf(amount, 0) && !math.IsNaN(amount)
+}
+
+func validUnit(unit string) bool {
+	return unit == UnitGram || unit == UnitMilligram || unit == UnitMicrogram || unit == UnitInternationalUnit
+}
+
+func invalidParam(name string) string {
+	err := ErrInvalidParam(name)
+	return err.Error()
+}
@@ -0,0 +1,132 @@
+package food
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateNutrients(t *testing.T) {
+	// 100 g of cooked chicken breast
+	valid := func() Food {
+		return Food{
+			Name:           "chicken breast",
+			Calories:       165,
+			Protein:        31,
+			Fat:            3.6,
+			Sodium:         74,
+			Micronutrients: map[string]Nutrient{"Vitamin B6": {Amount: 0.6, Unit: "mg"}},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		change func(food *Food)
+		want   string
+	}{
+		{"accepts consistent nutrients", func(food *Food) {}, ""},
+		{"accepts unknown macros", func(food *Food) { food.Protein, food.Fat = 0, 0 }, ""},
+		{"accepts calories within the tolerance", func(food *Food) { food.Calories = 190 }, ""},
+		{"accepts low calorie foods within the minimum tolerance", func(food *Food) { *food = Food{Calories: 5, Carbohydrates: 3} }, ""},
+		{"refuses negative calories", func(food *Food) { food.Calories = -1 }, "Invalid parameter: Calories"},
+		{"refuses negative macros", func(food *Food) { food.Fat = -1 }, "Invalid parameter: Fat"},
+		{"refuses negative sodium", func(food *Food) { food.Sodium = -74 }, "Invalid parameter: Sodium"},
+		{"refuses infinite amounts", func(food *Food) { food.Protein = math.Inf(1) }, "Invalid parameter: Protein"},
+		{"refuses more fiber than carbohydrates", func(food *Food) { food.Fiber = 1 }, "Invalid parameter: Fiber"},
+		{"refuses more sugar than carbohydrates", func(food *Food) { food.Carbohydrates, food.Sugar = 1, 2 }, "Invalid parameter: Sugar"},
+		{"refuses calories far from the macros", func(food *Food) { food.Calories = 400 }, ErrInconsistentCalories + " (156 kcal)"},
+		{"refuses unknown units", func(food *Food) {
+			food.Micronutrients["Iron"] = Nutrient{Amount: 1, Unit: "spoons"}
+		}, "Invalid parameter: Micronutrients.Iron"},
+		{"refuses negative micronutrients", func(food *Food) {
+			food.Micronutrients["Iron"] = Nutrient{Amount: -1, Unit: "mg"}
+		}, "Invalid parameter: Micronutrients.Iron"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			food := valid()
+			c.change(&food)
+
+			if got := validateNutrients(&food); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+
+	t.Run("Normalizes unit spellings", func(t *testing.T) {
+		food := valid()
+		food.Micronutrients["Vitamin B12"] = Nutrient{Amount: 0.3, Unit: "mcg"}
+
+		validateNutrients(&food)
+
+		if food.Micronutrients["Vitamin B12"].Unit != UnitMicrogram {
+			t.Errorf("got %q, want %q", food.Micronutrients["Vitamin B12"].Unit, UnitMicrogram)
+		}
+	})
+}
+
+func TestPostFoodNutrients(t *testing.T) {
+	t.Run("Delivers the nutrients of the created food", func(t *testing.T) {
+		server := &FoodsServer{Store: &InMemoryFoodsStore{}}
+		body := `{"name": "oats", "calories": 389, "protein": 16.9, "carbohydrates": 66.3, "fat": 6.9, "fiber": 10.6,
+			"sugar": 0.9, "sodium": 2, "micronutrients": {"Iron": {"amount": 4.7, "unit": "mg"}}}`
+
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodPost, "/foods", strings.NewReader(body))
+		server.ServeHTTP(response, request)
+
+		got := decodeFood(t, response)
+		want := Food{
+			ID:             got.ID,
+			Name:           "oats",
+			Basis:          BasisMass,
+			Calories:       389,
+			Protein:        16.9,
+			Carbohydrates:  66.3,
+			Fat:            6.9,
+			Fiber:          10.6,
+			Sugar:          0.9,
+			Sodium:         2,
+			Micronutrients: map[string]Nutrient{"Iron": {Amount: 4.7, Unit: UnitMilligram}},
+		}
+		assertStatus(t, response.Code, http.StatusCreated)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers 422 status code without storing invalid nutrients", func(t *testing.T) {
+		stored := Food{ID: "any-id", Name: "food", Calories: 100}
+		store := &InMemoryFoodsStore{Foods: []Food{stored}}
+		server := &FoodsServer{Store: store}
+
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch} {
+			path := "/foods"
+			if method != http.MethodPost {
+				path = "/foods/any-id"
+			}
+			response := makeFoodRequest(server, method, path, `{"name": "food", "calories": 100, "protein": -1}`)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+
+		if !reflect.DeepEqual(store.Foods, []Food{stored}) {
+			t.Errorf("got %v, want %v", store.Foods, []Food{stored})
+		}
+	})
+}
+
+func decodeFood(t *testing.T, response *httptest.ResponseRecorder) Food {
+	t.Helper()
+	var got Food
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("Unable to decode: error %q", err)
+	}
+	return got
+}
@@ -0,0 +1,275 @@
+package food
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultFoodsPageSize is how many foods are listed when no limit is given
+const DefaultFoodsPageSize = 50
+
+// MaxFoodsPageSize caps the limit callers may ask for
+const MaxFoodsPageSize = 100
+
+// FoodSort field foods are listed by, "name" or one of the nutrients
+type FoodSort string
+
+// SortByName sorts foods alphabetically, ignoring case and accents
+const SortByName FoodSort = "name"
+
+// Range struct type, bounds are inclusive and nil ones are open
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+// FoodQuery text, nutrient ranges, order and page of a food listing. Text matches
+// anywhere in names ignoring case and accents, Ranges are keyed by nutrient, e.g.
+// "Calories". After resumes the listing past the cursor of the previous page
+type FoodQuery struct {
+	Text       string
+	Ranges     map[string]Range
+	Sort       FoodSort
+	Descending bool
+	After      *FoodCursor
+	Limit      int
+}
+
+// FoodCursor position of a food in a listing: its folded name or nutrient value, then its ID
+type FoodCursor struct {
+	Name  string
+	Value float64
+	ID    string
+}
+
+// FoodPage foods of a listing page, the count of all foods matching the query and
+// whether more follow
+type FoodPage struct {
+	Foods []Food
+	Total int
+	More  bool
+}
+
+// encodedFoodCursor is what clients get back, bound to the order it was issued for
+type encodedFoodCursor struct {
+	Sort       FoodSort `json:"s"`
+	Descending bool     `json:"d"`
+	Name       string   `json:"n,omitempty"`
+	Value      float64  `json:"v,omitempty"`
+	ID         string   `json:"i"`
+}
+
+// nutrientFields filterable and sortable nutrients, by the name used in params
+var nutrientFields = map[string]func(food Food) float64{
+	"Calories":      func(food Food) float64 { return float64(food.Calories) },
+	"Protein":       func(food Food) float64 { return food.Protein },
+	"Carbohydrates": func(food Food) float64 { return food.Carbohydrates },
+	"Fat":           func(food Food) float64 { return food.Fat },
+	"Fiber":         func(food Food) float64 { return food.Fiber },
+	"Sugar":         func(food Food) float64 { return food.Sugar },
+	"Sodium":        func(food Food) float64 { return food.Sodium },
+}
+
+// handleGetFoods lists foods a page at a time, e.g. ?q=yog&maxCalories=100&sort=-protein.
+// The total count is sent in X-Total-Count and the next page's cursor in X-Next-Cursor
+func handleGetFoods(f *FoodsServer, w http.ResponseWriter, req *http.Request) {
+	query, invalidParams := parseFoodQuery(req)
+	if invalidParams != "" {
+		err := ErrInvalidParam(invalidParams)
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	page, err := f.Store.SearchFoods(query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.More && len(page.Foods) > 0 {
+		w.Header().Set("X-Next-Cursor", encodeFoodCursor(query, query.cursorOf(page.Foods[len(page.Foods)-1])))
+	}
+
+	respondWithSuccess(w, http.StatusOK, page.Foods)
+}
+
+// parseFoodQuery reads the listing params, delivering the names of the invalid ones
+func parseFoodQuery(req *http.Request) (query FoodQuery, invalidParams string) {
+	params := req.URL.Query()
+	query = FoodQuery{Text: strings.TrimSpace(params.Get("q")), Ranges: map[string]Range{}, Sort: SortByName, Limit: DefaultFoodsPageSize}
+
+	for nutrient := range nutrientFields {
+		var bounds Range
+		for _, bound := range []struct {
+			param string
+			value **float64
+		}{{"min" + nutrient, &bounds.Min}, {"max" + nutrient, &bounds.Max}} {
+			given := params.Get(bound.param)
+			if given == "" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(given, 64)
+			if err != nil || !validAmount(parsed) {
+				invalidParams += bound.param + ", "
+				continue
+			}
+			*bound.value = &parsed
+		}
+		if bounds.Min != nil || bounds.Max != nil {
+			query.Ranges[nutrient] = bounds
+		}
+	}
+
+	if order := params.Get("sort"); order != "" {
+		query.Descending = strings.HasPrefix(order, "-")
+		query.Sort = FoodSort(strings.ToLower(strings.TrimPrefix(order, "-")))
+		if query.Sort != SortByName && query.nutrient() == nil {
+			invalidParams += "sort, "
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			invalidParams += "limit, "
+		} else if parsed < MaxFoodsPageSize {
+			query.Limit = parsed
+		} else {
+			query.Limit = MaxFoodsPageSize
+		}
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, ok := decodeFoodCursor(query, cursor)
+		if !ok {
+			invalidParams += "cursor, "
+		}
+		query.After = &after
+	}
+
+	return query, sortedParams(invalidParams)
+}
+
+// sortedParams orders the comma separated param names, ranges are parsed in map order
+func sortedParams(params string) string {
+	if params == "" {
+		return ""
+	}
+	names := strings.Split(strings.TrimSuffix(params, ", "), ", ")
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func encodeFoodCursor(query FoodQuery, cursor FoodCursor) string {
+	data, _ := json.Marshal(encodedFoodCursor{Sort: query.Sort, Descending: query.Descending, Name: cursor.Name, Value: cursor.Value, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFoodCursor refuses cursors issued for another order, their position would be meaningless
+func decodeFoodCursor(query FoodQuery, cursor string) (FoodCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return FoodCursor{}, false
+	}
+
+	var decoded encodedFoodCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Sort != query.Sort || decoded.Descending != query.Descending {
+		return FoodCursor{}, false
+	}
+	return FoodCursor{Name: decoded.Name, Value: decoded.Value, ID: decoded.ID}, true
+}
+
+// nutrient delivers how to read the nutrient sorted by, nil when sorting by name
+func (q FoodQuery) nutrient() func(food Food) float64 {
+	for name, field := range nutrientFields {
+		if strings.EqualFold(name, string(q.Sort)) {
+			return field
+		}
+	}
+	return nil
+}
+
+// matches tells whether food passes the query's text and ranges
+func (q FoodQuery) matches(food Food) bool {
+	if q.Text != "" && !strings.Contains(foldText(food.Name), foldText(q.Text)) {
+		return false
+	}
+
+	for nutrient, bounds := range q.Ranges {
+		field, ok := nutrientFields[nutrient]
+		if !ok {
+			continue
+		}
+		value := field(food)
+		if (bounds.Min != nil && value < *bounds.Min) || (bounds.Max != nil && value > *bounds.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// cursorOf delivers the position of food in the query's order
+func (q FoodQuery) cursorOf(food Food) FoodCursor {
+	if field := q.nutrient(); field != nil {
+		return FoodCursor{Value: field(food), ID: food.ID}
+	}
+	return FoodCursor{Name: foldText(food.Name), ID: food.ID}
+}
+
+// before tells whether position a is listed before b in the query's order
+func (q FoodQuery) before(a FoodCursor, b FoodCursor) bool {
+	if a.Name != b.Name {
+		return (a.Name < b.Name) != q.Descending
+	}
+	if a.Value != b.Value {
+		return (a.Value < b.Value) != q.Descending
+	}
+	if a.ID != b.ID {
+		return (a.ID < b.ID) != q.Descending
+	}
+	return false
+}
+
+// accentFolds base letters of the accented Latin letters food names commonly use
+var accentFolds = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c',
+	'ď': 'd', 'đ': 'd',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ė': 'e', 'ę': 'e', 'ě': 'e',
+	'ğ': 'g',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i', 'į': 'i', 'ı': 'i',
+	'ł': 'l', 'ľ': 'l',
+	'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ő': 'o',
+	'ř': 'r',
+	'ś': 's', 'š': 's', 'ş': 's', 'ș': 's',
+	'ť': 't', 'ţ': 't', 'ț': 't',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u', 'ű': 'u', 'ų': 'u',
+	'ý': 'y', 'ÿ': 'y',
+	'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// ligatureFolds spells out the letters that fold into more than one base letter
+var ligatureFolds = map[rune]string{'æ': "ae", 'œ': "oe", 'ß': "ss", 'ﬀ': "ff", 'ﬁ': "fi", 'ﬂ': "fl"}
+
+// foldText lower cases text and strips accents, so "Crème Brûlée" matches "creme brulee"
+// whether its accents come precomposed or as combining marks after the base letter
+func foldText(text string) string {
+	var folded strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if base, ok := accentFolds[r]; ok {
+			folded.WriteRune(base)
+		} else if letters, ok := ligatureFolds[r]; ok {
+			folded.WriteString(letters)
+		} else if !unicode.Is(unicode.Mn, r) {
+			folded.WriteRune(r)
+		}
+	}
+	return folded.String()
+}
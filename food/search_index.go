@@ -0,0 +1,445 @@
+package food
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Sizes of the fuzzy search results
+const (
+	DefaultSearchResults = 20
+	MaxSearchResults     = 100
+)
+
+// ErrNoSearchIndex constant for error message
+const ErrNoSearchIndex = "Food search not available"
+
+// Relevance of a query word to a name word, the best match counts
+const (
+	scoreExact       = 1.0
+	scorePrefix      = 0.9
+	scoreSubstring   = 0.7
+	scoreTypo        = 0.6
+	scoreTypedPrefix = 0.5
+	scorePerEdit     = 0.1
+	synonymPenalty   = 0.9
+)
+
+// Bonuses favoring names matching the whole query
+const (
+	bonusExactName  = 1.0
+	bonusPrefixName = 0.5
+)
+
+// DefaultSynonyms groups of words naming the same food in different regions or spellings
+var DefaultSynonyms = [][]string{
+	{"yogurt", "yoghurt", "yogourt"},
+	{"chickpea", "garbanzo"},
+	{"zucchini", "courgette"},
+	{"eggplant", "aubergine"},
+	{"cilantro", "coriander"},
+	{"arugula", "rocket"},
+	{"shrimp", "prawn"},
+	{"cookie", "biscuit"},
+	{"fries", "chips"},
+	{"candy", "sweets"},
+}
+
+// ScoredFood struct type, a search result and how relevant it is
+type ScoredFood struct {
+	Food
+	Score float64
+}
+
+// SearchIndex in-process fuzzy index of food names. Candidates share a trigram with
+// a query word, they are then ranked by edit distance favoring exact and prefix
+// matches. Words are compared ignoring case and accents
+type SearchIndex struct {
+	mu       sync.RWMutex
+	foods    map[string]indexedFood
+	trigrams map[string]map[string]bool
+	synonyms map[string][]string
+}
+
+type indexedFood struct {
+	food  Food
+	name  string
+	words []string
+}
+
+// NewSearchIndex creates an empty index expanding query words with synonyms, given as
+// groups of single words
+func NewSearchIndex(synonyms [][]string) *SearchIndex {
+	index := &SearchIndex{foods: map[string]indexedFood{}, trigrams: map[string]map[string]bool{}, synonyms: map[string][]string{}}
+	for _, group := range synonyms {
+		for _, word := range group {
+			word = foldText(strings.TrimSpace(word))
+			for _, synonym := range group {
+				if synonym = foldText(strings.TrimSpace(synonym)); synonym != word {
+					index.synonyms[word] = append(index.synonyms[word], synonym)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// Add indexes food, replacing the food with the same ID
+func (s *SearchIndex) Add(food Food) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(food.ID)
+	name := foldText(food.Name)
+	indexed := indexedFood{food: food, name: strings.Join(searchWords(name), " "), words: searchWords(name)}
+	s.foods[food.ID] = indexed
+
+	for _, word := range indexed.words {
+		for _, trigram := range trigramsOf(word) {
+			if s.trigrams[trigram] == nil {
+				s.trigrams[trigram] = map[string]bool{}
+			}
+			s.trigrams[trigram][food.ID] = true
+		}
+	}
+}
+
+// Remove drops the food with id from the index
+func (s *SearchIndex) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+}
+
+// Len delivers how many foods are indexed
+func (s *SearchIndex) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.foods)
+}
+
+func (s *SearchIndex) remove(id string) {
+	indexed, ok := s.foods[id]
+	if !ok {
+		return
+	}
+
+	for _, word := range indexed.words {
+		for _, trigram := range trigramsOf(word) {
+			delete(s.trigrams[trigram], id)
+			if len(s.trigrams[trigram]) == 0 {
+				delete(s.trigrams, trigram)
+			}
+		}
+	}
+	delete(s.foods, id)
+}
+
+// Search delivers up to limit foods matching every word of text, most relevant first
+func (s *SearchIndex) Search(text string, limit int) []ScoredFood {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := searchWords(foldText(text))
+	if len(query) == 0 {
+		return []ScoredFood{}
+	}
+
+	alternatives := make([][]string, len(query))
+	candidates := map[string]bool{}
+	for index, word := range query {
+		alternatives[index] = append([]string{word}, s.synonyms[word]...)
+		for _, alternative := range alternatives[index] {
+			for _, trigram := range trigramsOf(alternative) {
+				for id := range s.trigrams[trigram] {
+					candidates[id] = true
+				}
+			}
+		}
+	}
+
+	results := []ScoredFood{}
+	for id := range candidates {
+		indexed := s.foods[id]
+		if score := s.score(indexed, query, alternatives); score > 0 {
+			results = append(results, ScoredFood{Food: indexed.food, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		if nameA, nameB := foldText(results[a].Name), foldText(results[b].Name); nameA != nameB {
+			return nameA < nameB
+		}
+		return results[a].ID < results[b].ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// score averages how well each query word matches the name, 0 when any doesn't
+func (s *SearchIndex) score(indexed indexedFood, query []string, alternatives [][]string) float64 {
+	total := 0.0
+	for index := range query {
+		best := 0.0
+		for position, alternative := range alternatives[index] {
+			penalty := 1.0
+			if position > 0 {
+				penalty = synonymPenalty
+			}
+			for _, word := range indexed.words {
+				if score := wordScore(alternative, word) * penalty; score > best {
+					best = score
+				}
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+
+	score := total / float64(len(query))
+	joined := strings.Join(query, " ")
+	if indexed.name == joined {
+		score += bonusExactName
+	} else if strings.HasPrefix(indexed.name, joined) {
+		score += bonusPrefixName
+	}
+	return score
+}
+
+// handleSearchFoods ranks the foods by how well their names match q, e.g. ?q=brocoli&limit=5,
+// tolerating typos and synonyms
+func handleSearchFoods(f *FoodsServer, w http.ResponseWriter, req *http.Request) {
+	if f.Index == nil {
+		respondWithError(w, http.StatusNotFound, ErrNoSearchIndex)
+		return
+	}
+
+	params := req.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		err := ErrMissingParam("q")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	limit := DefaultSearchResults
+	if given := params.Get("limit"); given != "" {
+		parsed, err := strconv.Atoi(given)
+		if err != nil || parsed < 1 {
+			err := ErrInvalidParam("limit")
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if limit = parsed; limit > MaxSearchResults {
+			limit = MaxSearchResults
+		}
+	}
+
+	respondWithSuccess(w, http.StatusOK, f.Index.Search(text, limit))
+}
+
+// wordScore rates how well the query word matches the name word, 0 when it doesn't
+func wordScore(query string, word string) float64 {
+	switch {
+	case query == word:
+		return scoreExact
+	case strings.HasPrefix(word, query):
+		return scorePrefix
+	case len([]rune(query)) >= 3 && strings.Contains(word, query):
+		return scoreSubstring
+	}
+
+	allowed := allowedEdits(query)
+	if allowed == 0 {
+		return 0
+	}
+
+	if edits := editDistance(query, word); edits <= allowed {
+		return scoreTypo - scorePerEdit*float64(edits-1)
+	}
+
+	// Words still being typed, e.g. "brocc" for "broccoli"
+	queryRunes, wordRunes := []rune(query), []rune(word)
+	if len(wordRunes) > len(queryRunes) {
+		if edits := editDistance(query, string(wordRunes[:len(queryRunes)])); edits <= allowed {
+			return scoreTypedPrefix - scorePerEdit*float64(edits-1)
+		}
+	}
+	return 0
+}
+
+// allowedEdits tolerates more typos in longer words, none in very short ones
+func allowedEdits(word string) int {
+	switch length := len([]rune(word)); {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the insertions, deletions, substitutions and adjacent
+// transpositions turning a into b (optimal string alignment distance)
+func editDistance(a string, b string) int {
+	first, second := []rune(a), []rune(b)
+	rows := make([][]int, len(first)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(second)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			rows[i][j] = minInt(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && first[i-1] == second[j-2] && first[i-2] == second[j-1] {
+				rows[i][j] = minInt(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(first)][len(second)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// trigramsOf delivers the trigrams of word padded at both ends, so short words and
+// word starts still have some
+func trigramsOf(word string) []string {
+	padded := []rune("  " + word + " ")
+	trigrams := make([]string, 0, len(padded)-2)
+	for index := 0; index+3 <= len(padded); index++ {
+		trigrams = append(trigrams, string(padded[index:index+3]))
+	}
+	return trigrams
+}
+
+// searchWords splits folded text into words of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// IndexedFoodsStore wraps a FoodsStore keeping Index in sync with every change made
+// through it
+type IndexedFoodsStore struct {
+	Store FoodsStore
+	Index *SearchIndex
+}
+
+// Reindex adds every stored food to Index, for foods stored before wrapping
+func (s *IndexedFoodsStore) Reindex() error {
+	foods, err := s.Store.GetFoods()
+	if err != nil {
+		return err
+	}
+	for _, food := range foods {
+		s.Index.Add(food)
+	}
+	return nil
+}
+
+// GetFoods returns the stored Foods
+func (s *IndexedFoodsStore) GetFoods() ([]Food, error) {
+	return s.Store.GetFoods()
+}
+
+// SearchFoods returns the page of stored Foods matching query
+func (s *IndexedFoodsStore) SearchFoods(query FoodQuery) (FoodPage, error) {
+	return s.Store.SearchFoods(query)
+}
+
+// PostFood stores and indexes food
+func (s *IndexedFoodsStore) PostFood(food Food) (Food, error) {
+	posted, err := s.Store.PostFood(food)
+	if err == nil {
+		s.Index.Add(posted)
+	}
+	return posted, err
+}
+
+// GetFood returns the stored Food with id
+func (s *IndexedFoodsStore) GetFood(id string) (Food, error) {
+	return s.Store.GetFood(id)
+}
+
+// UpdateFood stores and reindexes food
+func (s *IndexedFoodsStore) UpdateFood(food Food) (Food, error) {
+	updated, err := s.Store.UpdateFood(food)
+	if err == nil {
+		s.Index.Add(updated)
+	}
+	return updated, err
+}
+
+// DeleteFood deletes the Food with id and drops it from the index
+func (s *IndexedFoodsStore) DeleteFood(id string) error {
+	err := s.Store.DeleteFood(id)
+	if err == nil {
+		s.Index.Remove(id)
+	}
+	return err
+}
+
+// FoodsOwnedBy returns the stored Foods created by owner
+func (s *IndexedFoodsStore) FoodsOwnedBy(owner string) ([]Food, error) {
+	return s.Store.FoodsOwnedBy(owner)
+}
+
+// TransferFoods hands the Foods created by from over to to, reindexing them
+func (s *IndexedFoodsStore) TransferFoods(from string, to string) error {
+	if err := s.Store.TransferFoods(from, to); err != nil {
+		return err
+	}
+	foods, err := s.Store.FoodsOwnedBy(to)
+	if err != nil {
+		return err
+	}
+	for _, food := range foods {
+		s.Index.Add(food)
+	}
+	return nil
+}
+
+// DeleteFoodsOwnedBy deletes the Foods created by owner and drops them from the index
+func (s *IndexedFoodsStore) DeleteFoodsOwnedBy(owner string) error {
+	foods, err := s.Store.FoodsOwnedBy(owner)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteFoodsOwnedBy(owner); err != nil {
+		return err
+	}
+	for _, food := range foods {
+		s.Index.Remove(food.ID)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package food
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"broccoli", "broccoli", 0},
+		{"brocoli", "broccoli", 1},
+		{"yoghurt", "yogurt", 1},
+		{"bnaana", "banana", 1},
+		{"tomatos", "tomatoes", 1},
+		{"kale", "", 4},
+	}
+
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("got %d between %q and %q, want %d", got, c.a, c.b, c.want)
+		}
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	index := NewSearchIndex(DefaultSynonyms)
+	for _, food := range []Food{
+		{ID: "1", Name: "Broccoli", Calories: 34},
+		{ID: "2", Name: "Broccoli Soup", Calories: 50},
+		{ID: "3", Name: "Steamed Broccoli", Calories: 35},
+		{ID: "4", Name: "Greek Yogurt", Calories: 97},
+		{ID: "5", Name: "Chickpea Curry", Calories: 160},
+		{ID: "6", Name: "Banana", Calories: 89},
+		{ID: "7", Name: "Crème Brûlée", Calories: 330},
+	} {
+		index.Add(food)
+	}
+
+	t.Run("Ranks exact, then prefix, then other matches", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("broccoli", 0), []string{"1", "2", "3"})
+	})
+
+	t.Run("Tolerates typos", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("brocoli", 0), []string{"1", "2", "3"})
+		assertSearchIDs(t, index.Search("bnaana", 0), []string{"6"})
+	})
+
+	t.Run("Matches words still being typed", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("gre yog", 0), []string{"4"})
+		assertSearchIDs(t, index.Search("brocc", 1), []string{"1"})
+	})
+
+	t.Run("Expands synonyms", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("garbanzo", 0), []string{"5"})
+		assertSearchIDs(t, index.Search("YOGHOURT", 0), []string{"4"})
+	})
+
+	t.Run("Ignores how accents are encoded", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("cre\u0300me brule\u0301e", 0), []string{"7"})
+		assertSearchIDs(t, index.Search("creme brulee", 0), []string{"7"})
+	})
+
+	t.Run("Requires every word to match", func(t *testing.T) {
+		assertSearchIDs(t, index.Search("broccoli curry", 0), []string{})
+		assertSearchIDs(t, index.Search("xyz", 0), []string{})
+	})
+
+	t.Run("Scores exact matches highest", func(t *testing.T) {
+		results := index.Search("brocoli", 0)
+		if exact := index.Search("broccoli", 1); exact[0].Score <= results[0].Score {
+			t.Errorf("got %v for the exact match, want more than %v for the typo", exact[0].Score, results[0].Score)
+		}
+	})
+}
+
+func TestIndexedFoodsStore(t *testing.T) {
+	store := &IndexedFoodsStore{Store: &InMemoryFoodsStore{Foods: []Food{{ID: "1", Name: "Apple", Calories: 52, Owner: "ann"}}}, Index: NewSearchIndex(nil)}
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("got %v, want reindexed", err)
+	}
+	assertSearchIDs(t, store.Index.Search("aple", 0), []string{"1"})
+
+	store.PostFood(Food{ID: "2", Name: "Pear", Calories: 57, Owner: "ann"})
+	assertSearchIDs(t, store.Index.Search("pear", 0), []string{"2"})
+
+	store.UpdateFood(Food{ID: "2", Name: "Apricot", Calories: 48, Owner: "ann"})
+	assertSearchIDs(t, store.Index.Search("pear", 0), []string{})
+	assertSearchIDs(t, store.Index.Search("apricot", 0), []string{"2"})
+
+	store.TransferFoods("ann", "bob")
+	if got := store.Index.Search("apple", 0)[0].Owner; got != "bob" {
+		t.Errorf("got owner %q, want bob", got)
+	}
+
+	store.DeleteFood("1")
+	assertSearchIDs(t, store.Index.Search("apple", 0), []string{})
+
+	store.DeleteFoodsOwnedBy("bob")
+	if got := store.Index.Len(); got != 0 {
+		t.Errorf("got %d indexed foods, want none", got)
+	}
+}
+
+func TestSearchFoodsEndpoint(t *testing.T) {
+	index := NewSearchIndex(DefaultSynonyms)
+	server := &FoodsServer{Store: &IndexedFoodsStore{Store: &InMemoryFoodsStore{Foods: []Food{}}, Index: index}, Index: index}
+
+	t.Run("Finds posted foods by misspelled name", func(t *testing.T) {
+		makeFoodRequest(server, http.MethodPost, "/foods", `{"Name": "Broccoli", "Calories": 34}`)
+		makeFoodRequest(server, http.MethodPost, "/foods", `{"Name": "Broccoli Soup", "Calories": 50}`)
+
+		response := makeFoodRequest(server, http.MethodGet, "/foods/search?q=brocoli&limit=1", "")
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var got []ScoredFood
+		json.NewDecoder(response.Body).Decode(&got)
+		if len(got) != 1 || got[0].Name != "Broccoli" || got[0].ID == "" || got[0].Score <= 0 {
+			t.Errorf("got %+v, want only Broccoli", got)
+		}
+	})
+
+	t.Run("Delivers 422 status code when q is missing", func(t *testing.T) {
+		response := makeFoodRequest(server, http.MethodGet, "/foods/search?q=+", "")
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertMissingParam(t, response.Body.String(), "q")
+	})
+
+	t.Run("Delivers 422 status code on an invalid limit", func(t *testing.T) {
+		response := makeFoodRequest(server, http.MethodGet, "/foods/search?q=soup&limit=none", "")
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), "Invalid parameter: limit")
+	})
+
+	t.Run("Delivers 405 status code on other methods", func(t *testing.T) {
+		response := makeFoodRequest(server, http.MethodPost, "/foods/search", "")
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("Delivers 404 status code without an index", func(t *testing.T) {
+		response := makeFoodRequest(&FoodsServer{Store: &InMemoryFoodsStore{}}, http.MethodGet, "/foods/search?q=soup", "")
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		assertError(t, response.Body.String(), ErrNoSearchIndex)
+	})
+}
+
+func assertSearchIDs(t *testing.T, results []ScoredFood, want []string) {
+	t.Helper()
+	got := []string{}
+	for _, result := range results {
+		got = append(got, result.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package food
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	cases := map[string]string{"Crème Brûlée": "creme brulee", "JALAPEÑO": "jalapeno", "Smørrebrød": "smorrebrod", "Plain": "plain",
+		"Cre\u0300me Bru\u0302le\u0301e": "creme brulee", "JALAPEN\u0303O": "jalapeno", "Œufs en cocotte": "oeufs en cocotte",
+		"Æbleskiver": "aebleskiver", "Weißwurst": "weisswurst", "WEIẞWURST": "weisswurst"}
+
+	for given, want := range cases {
+		if got := foldText(given); got != want {
+			t.Errorf("got %q for %q, want %q", got, given, want)
+		}
+	}
+}
+
+func TestSearchFoodsQuery(t *testing.T) {
+	t.Run("Lists by name with the default page size", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+
+		makeFoodRequest(&FoodsServer{Store: spy}, http.MethodGet, "/foods", "")
+
+		if spy.query.Sort != SortByName || spy.query.Descending || spy.query.Limit != DefaultFoodsPageSize || len(spy.query.Ranges) != 0 {
+			t.Errorf("got %+v, want all foods by name, %d per page", spy.query, DefaultFoodsPageSize)
+		}
+	})
+
+	t.Run("Passes text, ranges and order down to the store", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+
+		makeFoodRequest(&FoodsServer{Store: spy}, http.MethodGet, "/foods?q=+yog+&minCalories=50&maxCalories=150&maxSugar=5&sort=-protein&limit=20", "")
+
+		got := spy.query
+		if got.Text != "yog" || got.Sort != "protein" || !got.Descending || got.Limit != 20 {
+			t.Errorf("got %+v, want yog by most protein, 20 per page", got)
+		}
+
+		calories, sugar := got.Ranges["Calories"], got.Ranges["Sugar"]
+		if *calories.Min != 50 || *calories.Max != 150 || sugar.Min != nil || *sugar.Max != 5 || len(got.Ranges) != 2 {
+			t.Errorf("got %v, want 50 to 150 calories and at most 5 g of sugar", got.Ranges)
+		}
+	})
+
+	t.Run("Caps the page size", func(t *testing.T) {
+		spy := &FoodsStoreSpy{}
+
+		makeFoodRequest(&FoodsServer{Store: spy}, http.MethodGet, "/foods?limit=5000", "")
+
+		assertCallsCount(t, spy.query.Limit, MaxFoodsPageSize)
+	})
+
+	t.Run("Delivers 422 status code naming the invalid params", func(t *testing.T) {
+		response := makeFoodRequest(&FoodsServer{Store: &FoodsStoreSpy{}}, http.MethodGet, "/foods?sort=color&limit=0&minFat=-1&maxCalories=lots&cursor=not-a-cursor", "")
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), "Invalid parameter: cursor, limit, maxCalories, minFat, sort")
+	})
+}
+
+func TestSearchFoods(t *testing.T) {
+	makeSUT := func() (*FoodsServer, *InMemoryFoodsStore) {
+		store := &InMemoryFoodsStore{Foods: []Food{
+			{ID: "1", Name: "Greek Yoghurt", Calories: 97, Protein: 9},
+			{ID: "2", Name: "Crème fraîche", Calories: 292, Protein: 2.4},
+			{ID: "3", Name: "yogurt drink", Calories: 62, Protein: 3},
+			{ID: "4", Name: "Frozen Yogurt", Calories: 127, Protein: 3},
+			{ID: "5", Name: "broccoli", Calories: 34, Protein: 2.8},
+		}}
+		return &FoodsServer{Store: store}, store
+	}
+	idsOf := func(foods []Food) []string {
+		ids := []string{}
+		for _, food := range foods {
+			ids = append(ids, food.ID)
+		}
+		return ids
+	}
+	over := func(value float64) *float64 { return &value }
+
+	cases := []struct {
+		name  string
+		query FoodQuery
+		want  []string
+		total int
+		more  bool
+	}{
+		{"all by name ignoring case and accents", FoodQuery{Sort: SortByName}, []string{"5", "2", "4", "1", "3"}, 5, false},
+		{"substrings ignoring case", FoodQuery{Text: "YOG", Sort: SortByName}, []string{"4", "1", "3"}, 3, false},
+		{"text ignoring accents", FoodQuery{Text: "creme", Sort: SortByName}, []string{"2"}, 1, false},
+		{"accented text", FoodQuery{Text: "fraîch", Sort: SortByName}, []string{"2"}, 1, false},
+		{"nutrient ranges", FoodQuery{Ranges: map[string]Range{"Calories": {Min: over(60), Max: over(130)}}, Sort: SortByName}, []string{"4", "1", "3"}, 3, false},
+		{"nutrient descending, ties by ID", FoodQuery{Sort: "protein", Descending: true}, []string{"1", "4", "3", "5", "2"}, 5, false},
+		{"first page", FoodQuery{Sort: "calories", Limit: 2}, []string{"5", "3"}, 5, true},
+		{"after a cursor", FoodQuery{Sort: "calories", Limit: 2, After: &FoodCursor{Value: 62, ID: "3"}}, []string{"1", "4"}, 5, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, store := makeSUT()
+
+			got, err := store.SearchFoods(c.query)
+
+			if err != nil || !reflect.DeepEqual(idsOf(got.Foods), c.want) || got.Total != c.total || got.More != c.more {
+				t.Errorf("got %v, total %d, more %v and %v, want %v, total %d, more %v", idsOf(got.Foods), got.Total, got.More, err, c.want, c.total, c.more)
+			}
+		})
+	}
+
+	t.Run("Walks every page following the next cursor", func(t *testing.T) {
+		server, _ := makeSUT()
+
+		var got []Food
+		path := "/foods?sort=-calories&limit=2"
+		for pages := 0; pages < 10; pages++ {
+			response := makeFoodRequest(server, http.MethodGet, path, "")
+			assertStatus(t, response.Code, http.StatusOK)
+			assertError(t, response.Header().Get("X-Total-Count"), "5")
+
+			var foods []Food
+			json.NewDecoder(response.Body).Decode(&foods)
+			got = append(got, foods...)
+
+			cursor := response.Header().Get("X-Next-Cursor")
+			if cursor == "" {
+				break
+			}
+			path = "/foods?sort=-calories&limit=2&cursor=" + cursor
+		}
+
+		assertError(t, strings.Join(idsOf(got), " "), "2 4 1 3 5")
+	})
+
+	t.Run("Refuses cursors issued for another order", func(t *testing.T) {
+		server, _ := makeSUT()
+		first := makeFoodRequest(server, http.MethodGet, "/foods?sort=calories&limit=2", "")
+
+		response := makeFoodRequest(server, http.MethodGet, "/foods?sort=protein&limit=2&cursor="+first.Header().Get("X-Next-Cursor"), "")
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), "Invalid parameter: cursor")
+	})
+}
@@ -0,0 +1,168 @@
+package food
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Basis reference quantity a food's nutrients are declared for
+type Basis string
+
+// Supported bases, foods without one are taken per 100 g
+const (
+	BasisMass   Basis = "100g"
+	BasisVolume Basis = "100ml"
+)
+
+// Serving struct type, a named portion of a food, e.g. 1 slice = 30 g
+type Serving struct {
+	Name     string
+	Quantity float64
+	Unit     string
+}
+
+// Nutrition struct type, the nutrients of a quantity of a food
+type Nutrition struct {
+	Quantity       float64
+	Unit           string
+	Calories       float64
+	Protein        float64
+	Carbohydrates  float64
+	Fat            float64
+	Fiber          float64
+	Sugar          float64
+	Sodium         float64
+	Micronutrients map[string]Nutrient
+}
+
+// basisUnit delivers the unit of the food's basis
+func (f Food) basisUnit() string {
+	if f.Basis == BasisVolume {
+		return "ml"
+	}
+	return "g"
+}
+
+// NutrientsFor scales the food's nutrients to quantity of unit, which may be a
+// supported unit or the name of one of its servings
+func (f Food) NutrientsFor(quantity float64, unit string) (Nutrition, error) {
+	amount, from := quantity, unit
+	if serving, ok := f.serving(unit); ok {
+		amount, from = quantity*serving.Quantity, serving.Unit
+	}
+
+	converted, err := Convert(amount, from, f.basisUnit(), f.Density)
+	if err != nil {
+		return Nutrition{}, err
+	}
+
+	factor := converted / 100
+	nutrition := Nutrition{
+		Quantity:      quantity,
+		Unit:          unit,
+		Calories:      roundAmount(float64(f.Calories) * factor),
+		Protein:       roundAmount(f.Protein * factor),
+		Carbohydrates: roundAmount(f.Carbohydrates * factor),
+		Fat:           roundAmount(f.Fat * factor),
+		Fiber:         roundAmount(f.Fiber * factor),
+		Sugar:         roundAmount(f.Sugar * factor),
+		Sodium:        roundAmount(f.Sodium * factor),
+	}
+
+	if f.Micronutrients != nil {
+		nutrition.Micronutrients = map[string]Nutrient{}
+		for name, nutrient := range f.Micronutrients {
+			nutrition.Micronutrients[name] = Nutrient{Amount: roundAmount(nutrient.Amount * factor), Unit: nutrient.Unit}
+		}
+	}
+	return nutrition, nil
+}
+
+func (f Food) serving(name string) (Serving, bool) {
+	for _, serving := range f.Servings {
+		if strings.EqualFold(serving.Name, strings.TrimSpace(name)) {
+			return serving, true
+		}
+	}
+	return Serving{}, false
+}
+
+// validateServings delivers why the food's basis, density or servings are invalid,
+// or "" when they are fine, defaulting the basis to 100 g and normalizing units
+func validateServings(food *Food) string {
+	if food.Basis == "" {
+		food.Basis = BasisMass
+	}
+	if food.Basis != BasisMass && food.Basis != BasisVolume {
+		return invalidParam("Basis")
+	}
+
+	if !validAmount(food.Density) {
+		return invalidParam("Density")
+	}
+
+	names := map[string]bool{}
+	for index, serving := range food.Servings {
+		name := strings.ToLower(strings.TrimSpace(serving.Name))
+		if name == "" || names[name] || Unit(name) != "" {
+			return invalidParam("Servings.Name")
+		}
+		names[name] = true
+
+		if !validAmount(serving.Quantity) || serving.Quantity == 0 {
+			return invalidParam("Servings." + serving.Name)
+		}
+
+		unit := Unit(serving.Unit)
+		if unit == "" {
+			return invalidParam("Servings." + serving.Name)
+		}
+		food.Servings[index].Unit = unit
+
+		if _, err := Convert(serving.Quantity, unit, food.basisUnit(), food.Density); err != nil {
+			return invalidParam("Servings." + serving.Name)
+		}
+	}
+	return ""
+}
+
+// handleFoodNutrients delivers the nutrients of e.g. ?quantity=2&unit=slice of the food
+func handleFoodNutrients(f *FoodsServer, w http.ResponseWriter, req *http.Request, id string) {
+	params := req.URL.Query()
+	if params.Get("quantity") == "" || params.Get("unit") == "" {
+		err := ErrMissingParam("quantity, unit")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	quantity, err := strconv.ParseFloat(params.Get("quantity"), 64)
+	if err != nil || !validAmount(quantity) {
+		respondWithError(w, http.StatusUnprocessableEntity, invalidParam("quantity"))
+		return
+	}
+
+	food, err := f.Store.GetFood(id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	nutrition, err := food.NutrientsFor(quantity, params.Get("unit"))
+	if err == ErrUnknownUnit {
+		respondWithError(w, http.StatusUnprocessableEntity, invalidParam("unit"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	respondWithSuccess(w, http.StatusOK, nutrition)
+}
+
+// roundAmount keeps two decimals, enough for grams and milligrams alike
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,164 @@
+package food
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNutrientsFor(t *testing.T) {
+	bread := Food{
+		Name:           "bread",
+		Basis:          BasisMass,
+		Calories:       250,
+		Protein:        9,
+		Carbohydrates:  49,
+		Fat:            3,
+		Sodium:         500,
+		Micronutrients: map[string]Nutrient{"Iron": {Amount: 3.6, Unit: "mg"}},
+		Servings:       []Serving{{Name: "slice", Quantity: 30, Unit: "g"}},
+	}
+
+	t.Run("Scales nutrients to a named serving", func(t *testing.T) {
+		got, err := bread.NutrientsFor(2, "Slice")
+
+		want := Nutrition{
+			Quantity:       2,
+			Unit:           "Slice",
+			Calories:       150,
+			Protein:        5.4,
+			Carbohydrates:  29.4,
+			Fat:            1.8,
+			Sodium:         300,
+			Micronutrients: map[string]Nutrient{"Iron": {Amount: 2.16, Unit: "mg"}},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v and %v, want %v", got, err, want)
+		}
+	})
+
+	t.Run("Scales nutrients to imperial units", func(t *testing.T) {
+		got, _ := bread.NutrientsFor(1, "oz")
+
+		if got.Calories != 70.87 {
+			t.Errorf("got %v, want 70.87", got.Calories)
+		}
+	})
+
+	t.Run("Converts volumes to mass through the density", func(t *testing.T) {
+		flour := Food{Name: "flour", Calories: 364, Density: 0.53}
+
+		got, _ := flour.NutrientsFor(1, "cup")
+
+		if got.Calories != 456.43 {
+			t.Errorf("got %v, want 456.43", got.Calories)
+		}
+	})
+
+	t.Run("Scales foods declared per 100 ml", func(t *testing.T) {
+		milk := Food{Name: "milk", Basis: BasisVolume, Calories: 64}
+
+		got, _ := milk.NutrientsFor(0.5, "l")
+
+		if got.Calories != 320 {
+			t.Errorf("got %v, want 320", got.Calories)
+		}
+	})
+
+	t.Run("Delivers ErrNoDensity from volume to mass without one", func(t *testing.T) {
+		if _, err := bread.NutrientsFor(1, "cup"); err != ErrNoDensity {
+			t.Errorf("got %v, want %v", err, ErrNoDensity)
+		}
+	})
+}
+
+func TestValidateServings(t *testing.T) {
+	cases := []struct {
+		name string
+		food Food
+		want string
+	}{
+		{"accepts servings convertible to the basis", Food{Servings: []Serving{{Name: "slice", Quantity: 30, Unit: "grams"}}}, ""},
+		{"accepts volume servings with a density", Food{Density: 1.03, Servings: []Serving{{Name: "glass", Quantity: 1, Unit: "cup"}}}, ""},
+		{"refuses unknown bases", Food{Basis: "1kg"}, "Invalid parameter: Basis"},
+		{"refuses negative densities", Food{Density: -1}, "Invalid parameter: Density"},
+		{"refuses unnamed servings", Food{Servings: []Serving{{Quantity: 30, Unit: "g"}}}, "Invalid parameter: Servings.Name"},
+		{"refuses servings named like units", Food{Servings: []Serving{{Name: "Cup", Quantity: 30, Unit: "g"}}}, "Invalid parameter: Servings.Name"},
+		{"refuses repeated servings", Food{Servings: []Serving{{Name: "slice", Quantity: 30, Unit: "g"}, {Name: "Slice", Quantity: 40, Unit: "g"}}}, "Invalid parameter: Servings.Name"},
+		{"refuses empty servings", Food{Servings: []Serving{{Name: "slice", Unit: "g"}}}, "Invalid parameter: Servings.slice"},
+		{"refuses unknown units", Food{Servings: []Serving{{Name: "slice", Quantity: 1, Unit: "handful"}}}, "Invalid parameter: Servings.slice"},
+		{"refuses volume servings without a density", Food{Servings: []Serving{{Name: "glass", Quantity: 1, Unit: "cup"}}}, "Invalid parameter: Servings.glass"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := validateServings(&c.food); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+
+	t.Run("Defaults the basis and normalizes units", func(t *testing.T) {
+		food := Food{Servings: []Serving{{Name: "slice", Quantity: 30, Unit: "Grams"}}}
+
+		validateServings(&food)
+
+		if food.Basis != BasisMass || food.Servings[0].Unit != "g" {
+			t.Errorf("got %q and %q, want %q and g", food.Basis, food.Servings[0].Unit, BasisMass)
+		}
+	})
+}
+
+func TestFoodNutrients(t *testing.T) {
+	makeSUT := func() *FoodsServer {
+		return &FoodsServer{Store: &InMemoryFoodsStore{Foods: []Food{{
+			ID:       "any-id",
+			Name:     "bread",
+			Basis:    BasisMass,
+			Calories: 250,
+			Servings: []Serving{{Name: "slice", Quantity: 30, Unit: "g"}},
+		}}}}
+	}
+
+	t.Run("Delivers the nutrients of the quantity", func(t *testing.T) {
+		response := makeFoodRequest(makeSUT(), http.MethodGet, "/foods/any-id/nutrients?quantity=3&unit=slice", "")
+
+		var got Nutrition
+		json.NewDecoder(response.Body).Decode(&got)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		if got.Quantity != 3 || got.Unit != "slice" || got.Calories != 225 {
+			t.Errorf("got %v, want 225 calories for 3 slices", got)
+		}
+	})
+
+	t.Run("Delivers 422 status code on missing or invalid params", func(t *testing.T) {
+		cases := map[string]string{
+			"?unit=g":                  "Missing parameter: quantity, unit",
+			"?quantity=abc&unit=g":     "Invalid parameter: quantity",
+			"?quantity=-1&unit=g":      "Invalid parameter: quantity",
+			"?quantity=1&unit=handful": "Invalid parameter: unit",
+			"?quantity=1&unit=cup":     ErrNoDensity.Error(),
+		}
+
+		for query, want := range cases {
+			response := makeFoodRequest(makeSUT(), http.MethodGet, "/foods/any-id/nutrients"+query, "")
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+			assertError(t, response.Body.String(), want)
+		}
+	})
+
+	t.Run("Delivers 404 for unknown foods", func(t *testing.T) {
+		response := makeFoodRequest(makeSUT(), http.MethodGet, "/foods/unknown-id/nutrients?quantity=1&unit=g", "")
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Delivers 405 status code on other methods", func(t *testing.T) {
+		response := makeFoodRequest(makeSUT(), http.MethodPost, "/foods/any-id/nutrients", "")
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
@@ -0,0 +1,99 @@
+package food
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnknownUnit delivered when converting from or to a unit that isn't supported
+var ErrUnknownUnit = errors.New("Unknown unit")
+
+// ErrNoDensity delivered when converting between mass and volume without a density
+var ErrNoDensity = errors.New("Density needed to convert between mass and volume")
+
+// Dimension of a unit, quantities convert freely within one and through the
+// density between them
+type Dimension int
+
+// Supported dimensions
+const (
+	Mass Dimension = iota + 1
+	Volume
+)
+
+// unitFactor dimension of a unit and how many grams or millilitres one is
+type unitFactor struct {
+	dimension Dimension
+	base      float64
+}
+
+// Supported units, imperial volumes are US customary
+var units = map[string]unitFactor{
+	"mg":     {Mass, 0.001},
+	"g":      {Mass, 1},
+	"kg":     {Mass, 1000},
+	"oz":     {Mass, 28.349523125},
+	"lb":     {Mass, 453.59237},
+	"ml":     {Volume, 1},
+	"cl":     {Volume, 10},
+	"dl":     {Volume, 100},
+	"l":      {Volume, 1000},
+	"tsp":    {Volume, 4.92892159375},
+	"tbsp":   {Volume, 14.78676478125},
+	"floz":   {Volume, 29.5735295625},
+	"cup":    {Volume, 236.5882365},
+	"pint":   {Volume, 473.176473},
+	"quart":  {Volume, 946.352946},
+	"gallon": {Volume, 3785.411784},
+}
+
+// unitNames spellings accepted for supported units
+var unitNames = map[string]string{
+	"gram": "g", "grams": "g", "milligram": "mg", "milligrams": "mg", "kilogram": "kg", "kilograms": "kg",
+	"ounce": "oz", "ounces": "oz", "pound": "lb", "pounds": "lb", "lbs": "lb",
+	"millilitre": "ml", "milliliter": "ml", "millilitres": "ml", "milliliters": "ml",
+	"litre": "l", "liter": "l", "litres": "l", "liters": "l",
+	"teaspoon": "tsp", "teaspoons": "tsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"fl oz": "floz", "fluid ounce": "floz", "fluid ounces": "floz",
+	"cups": "cup", "pints": "pint", "pt": "pint", "quarts": "quart", "qt": "quart", "gallons": "gallon", "gal": "gallon",
+}
+
+// Unit delivers the canonical name of unit, e.g. "g" for "Grams", or "" when it isn't supported
+func Unit(unit string) string {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if canonical, ok := unitNames[unit]; ok {
+		return canonical
+	}
+	if _, ok := units[unit]; ok {
+		return unit
+	}
+	return ""
+}
+
+// UnitDimension delivers whether unit measures mass or volume, or 0 when it isn't supported
+func UnitDimension(unit string) Dimension {
+	return units[Unit(unit)].dimension
+}
+
+// Convert expresses amount of from in to. Converting between mass and volume takes
+// the density in grams per millilitre, which may be 0 for conversions within one
+func Convert(amount float64, from string, to string, density float64) (float64, error) {
+	fromUnit, fromOK := units[Unit(from)]
+	toUnit, toOK := units[Unit(to)]
+	if !fromOK || !toOK {
+		return 0, ErrUnknownUnit
+	}
+
+	base := amount * fromUnit.base
+	if fromUnit.dimension != toUnit.dimension {
+		if density <= 0 {
+			return 0, ErrNoDensity
+		}
+		if fromUnit.dimension == Mass {
+			base /= density
+		} else {
+			base *= density
+		}
+	}
+	return base / toUnit.base, nil
+}
@@ -0,0 +1,61 @@
+package food
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		amount  float64
+		from    string
+		to      string
+		density float64
+		want    float64
+	}{
+		{1.5, "kg", "g", 0, 1500},
+		{250, "mg", "g", 0, 0.25},
+		{1, "lb", "oz", 0, 16},
+		{100, "g", "oz", 0, 3.5274},
+		{1, "cup", "ml", 0, 236.5882},
+		{3, "tsp", "tbsp", 0, 1},
+		{1, "gallon", "quart", 0, 4},
+		{2, "Litres", "fl oz", 0, 67.628},
+		{1, "cup", "g", 1.03, 243.6859},
+		{100, "g", "ml", 0.92, 108.6957},
+	}
+
+	for _, c := range cases {
+		got, err := Convert(c.amount, c.from, c.to, c.density)
+
+		if err != nil || math.Abs(got-c.want) > 0.0001 {
+			t.Errorf("%v %s in %s: got %v and %v, want %v", c.amount, c.from, c.to, got, err, c.want)
+		}
+	}
+
+	t.Run("Delivers ErrUnknownUnit for unsupported units", func(t *testing.T) {
+		if _, err := Convert(1, "handful", "g", 0); err != ErrUnknownUnit {
+			t.Errorf("got %v, want %v", err, ErrUnknownUnit)
+		}
+	})
+
+	t.Run("Delivers ErrNoDensity between mass and volume without one", func(t *testing.T) {
+		if _, err := Convert(1, "cup", "g", 0); err != ErrNoDensity {
+			t.Errorf("got %v, want %v", err, ErrNoDensity)
+		}
+	})
+}
+
+func TestUnit(t *testing.T) {
+	cases := map[string]string{" Grams ": "g", "TBSP": "tbsp", "fl oz": "floz", "lbs": "lb", "handful": ""}
+
+	for given, want := range cases {
+		if got := Unit(given); got != want {
+			t.Errorf("got %q for %q, want %q", got, given, want)
+		}
+	}
+
+	if UnitDimension("cups") != Volume || UnitDimension("ounce") != Mass || UnitDimension("handful") != 0 {
+		t.Errorf("got wrong dimensions for cups, ounce and handful")
+	}
+}
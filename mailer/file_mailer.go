@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file in Dir instead of sending it,
+// useful for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to a new file in Dir
+func (f *FileMailer) Send(message Message) error {
+	if message.From == "" {
+		message.From = f.From
+	}
+
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), hex.EncodeToString(suffix))
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), message.bytes(now), 0600)
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message email message
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// A Mailer may deliver a message
+type Mailer interface {
+	Send(message Message) error
+}
+
+// bytes renders the message in RFC 5322 format with CRLF line endings
+func (m Message) bytes(date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
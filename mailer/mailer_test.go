@@ -0,0 +1,133 @@
+package mailer
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	t.Run("Writes every message to its own file", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "mail")
+		sut := &FileMailer{Dir: dir, From: "noreply@mail.com"}
+
+		assertNoError(t, sut.Send(Message{To: "any@mail.com", Subject: "Hello", Body: "line 1\nline 2"}))
+		assertNoError(t, sut.Send(Message{To: "other@mail.com", Subject: "Hi", Body: "body"}))
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(files) != 2 {
+			t.Fatalf("got %d files, want 2", len(files))
+		}
+
+		content := readMessages(t, files)
+		assertContains(t, content, "From: noreply@mail.com\r\n")
+		assertContains(t, content, "To: any@mail.com\r\n")
+		assertContains(t, content, "Subject: Hello\r\n")
+		assertContains(t, content, "\r\n\r\nline 1\r\nline 2")
+	})
+}
+
+func TestSMTPMailer(t *testing.T) {
+	t.Run("Delivers message to the SMTP server", func(t *testing.T) {
+		addr, received := startSMTPSink(t)
+		sut := &SMTPMailer{Addr: addr, From: "noreply@mail.com"}
+
+		assertNoError(t, sut.Send(Message{To: "any@mail.com", Subject: "Hello", Body: "body"}))
+
+		got := <-received
+		assertContains(t, got, "MAIL FROM:<noreply@mail.com>")
+		assertContains(t, got, "RCPT TO:<any@mail.com>")
+		assertContains(t, got, "Subject: Hello")
+		assertContains(t, got, "body")
+	})
+
+	t.Run("Delivers error when the server is unreachable", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := listener.Addr().String()
+		listener.Close()
+
+		if err := (&SMTPMailer{Addr: addr}).Send(Message{To: "any@mail.com"}); err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+// startSMTPSink accepts a single SMTP session and delivers its transcript
+func startSMTPSink(t *testing.T) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var transcript strings.Builder
+		reader := bufio.NewReader(conn)
+		write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		write("220 localhost ESMTP")
+
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			transcript.WriteString(line)
+
+			switch {
+			case inData && line == ".\r\n":
+				inData = false
+				write("250 OK")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				write("354 End data with <CR><LF>.<CR><LF>")
+			case strings.HasPrefix(line, "QUIT"):
+				write("221 Bye")
+				received <- transcript.String()
+				return
+			default:
+				write("250 OK")
+			}
+		}
+		received <- transcript.String()
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func readMessages(t *testing.T, files []string) string {
+	t.Helper()
+	var content strings.Builder
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assertNoError(t, err)
+		content.Write(data)
+	}
+	return content.String()
+}
+
+func assertContains(t *testing.T, got string, want string) {
+	t.Helper()
+	if !strings.Contains(got, want) {
+		t.Errorf("got %q, want it to contain %q", got, want)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer delivers messages to the SMTP server at Addr ("host:port"), such as
+// a local test sink. Credentials are only sent when Username is set
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send delivers the message through the SMTP server
+func (s *SMTPMailer) Send(message Message) error {
+	if message.From == "" {
+		message.From = s.From
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, message.From, []string{message.To}, message.bytes(time.Now()))
+}
@@ -3,12 +3,232 @@ package main
 import (
 	"api/encryption"
 	"api/food"
+	"api/mailer"
+	"api/signer"
 	"api/user"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
+// accessTokenTTL is how long tokens issued by the users server stay valid,
+// clients renew them through the refresh token endpoint
+const accessTokenTTL = 15 * time.Minute
+
+// foodsPolicy declares who may change the shared foods catalog, editors with a verified
+// email, reading it only needs a login, and the scopes API keys need on each route
+var foodsPolicy = user.Policy{
+	http.MethodGet + " /foods":             {Scope: user.ScopeFoodsRead},
+	http.MethodPost + " /foods":            {Roles: foodEditors, Scope: user.ScopeFoodsWrite, Verified: true},
+	http.MethodGet + " /foods/*":           {Scope: user.ScopeFoodsRead},
+	http.MethodGet + " /foods/*/nutrients": {Scope: user.ScopeFoodsRead},
+	http.MethodPut + " /foods/*":           {Roles: foodEditors, Scope: user.ScopeFoodsWrite, Verified: true},
+	http.MethodPatch + " /foods/*":         {Roles: foodEditors, Scope: user.ScopeFoodsWrite, Verified: true},
+	http.MethodDelete + " /foods/*":        {Roles: foodEditors, Scope: user.ScopeFoodsWrite, Verified: true},
+}
+
+var foodEditors = []user.Role{user.RoleAdmin, user.RoleEditor}
+
 func main() {
-	http.Handle("/foods", &food.FoodsServer{Store: &food.InMemoryFoodsStore{Foods: []food.Food{}}})
-	http.Handle("/users", &user.Server{Encrypter: &encryption.BCryptEncrypter{}, Store: &user.InMemoryUsersStore{Users: []user.DatabaseModel{}}})
+	bootstrapAdmin := flag.String("bootstrap-admin", "", "create the first admin with this email, its password read from ADMIN_PASSWORD")
+	flag.Parse()
+
+	tokens, err := newJWT()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens.Revocations = &signer.InMemoryRevocationList{}
+
+	encrypter, err := newEncrypter()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy, err := newPasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	usersStore := &user.InMemoryUsersStore{Users: []user.DatabaseModel{}}
+	apiKeys := &user.InMemoryAPIKeyStore{}
+	auth := &user.Authenticator{Verifier: tokens, Store: usersStore, APIKeys: apiKeys}
+
+	foodsIndex := food.NewSearchIndex(food.DefaultSynonyms)
+	foodsStore := &food.IndexedFoodsStore{Store: &food.InMemoryFoodsStore{Foods: []food.Food{}}, Index: foodsIndex}
+	foods := &food.FoodsServer{Store: foodsStore, Owner: foodOwner, Index: foodsIndex}
+	http.Handle("/foods", auth.Authorize(foodsPolicy, foods))
+	http.Handle("/foods/", auth.Authorize(foodsPolicy, foods))
+	users := &user.Server{
+		Encrypter:        encrypter,
+		Store:            usersStore,
+		Signer:           tokens,
+		Verifier:         tokens,
+		Revoker:          tokens,
+		RefreshTokens:    &user.InMemoryRefreshTokenStore{},
+		PasswordPolicy:   policy,
+		Throttle:         &user.LoginThrottle{Store: &user.InMemoryAttemptStore{}},
+		Mailer:           newMailer(),
+		BaseURL:          baseURL(),
+		PasswordResets:   &user.InMemoryPasswordResetStore{},
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+		PersonalData:     map[string]user.PersonalData{"foods": foods},
+		TwoFactors:       &user.InMemoryTwoFactorStore{},
+		APIKeys:          apiKeys,
+		OIDC:             newOIDCProvider(),
+		OIDCStates:       &user.InMemoryOIDCStateStore{},
+	}
+	if *bootstrapAdmin != "" {
+		err := users.BootstrapAdmin("admin", *bootstrapAdmin, os.Getenv("ADMIN_PASSWORD"))
+		if err == user.ErrAdminExists {
+			log.Println(err)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+	}
+	go purgeDeletedAccounts(users)
+	http.Handle("/.well-known/", &user.DiscoveryServer{Issuer: tokens.Issuer, Keys: tokens})
+	http.Handle("/users", users)
+	http.Handle("/users/", users)
 	http.ListenAndServe(":5000", nil)
 }
+
+// foodOwner is the email of the authenticated user creating a food
+func foodOwner(req *http.Request) string {
+	owner, _ := user.AuthenticatedUser(req.Context())
+	return owner.Email
+}
+
+// purgeDeletedAccounts removes accounts whose deletion grace period ended, hourly
+func purgeDeletedAccounts(users *user.Server) {
+	for now := range time.Tick(time.Hour) {
+		if err := users.PurgeDeletedAccounts(now); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// newJWT configures token signing from JWT_ALGORITHM (HS256, RS256 or ES256),
+// JWT_SECRET for HS256 and JWT_KEY_FILE for the asymmetric algorithms. After a
+// rotation, JWT_PREVIOUS_KEY_FILES lists the retired key files still accepted
+func newJWT() (tokens *signer.JWT, err error) {
+	switch signer.Algorithm(os.Getenv("JWT_ALGORITHM")) {
+	case signer.RS256:
+		tokens, err = signer.NewRS256(os.Getenv("JWT_KEY_FILE"), accessTokenTTL)
+	case signer.ES256:
+		tokens, err = signer.NewES256(os.Getenv("JWT_KEY_FILE"), accessTokenTTL)
+	default:
+		tokens, err = signer.NewHS256([]byte(os.Getenv("JWT_SECRET")), accessTokenTTL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens.Issuer = baseURL()
+	tokens.Audience = os.Getenv("JWT_AUDIENCE")
+	if tokens.Audience == "" {
+		tokens.Audience = tokens.Issuer
+	}
+	if files := os.Getenv("JWT_PREVIOUS_KEY_FILES"); files != "" {
+		for _, file := range strings.Split(files, ",") {
+			if err := tokens.AddPreviousKey(strings.TrimSpace(file)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// newEncrypter hashes with Argon2id while still accepting bcrypt hashes, peppered
+// with PASSWORD_PEPPERS ("id:base64,...") using PASSWORD_PEPPER_ID when set, which
+// must name one of them so a typo fails at startup rather than on every sign-up
+func newEncrypter() (encryption.Encrypter, error) {
+	var encrypter encryption.Encrypter = &encryption.MigratingEncrypter{
+		Current: &encryption.Argon2idEncrypter{},
+		Legacy:  []encryption.Encrypter{&encryption.BCryptEncrypter{}},
+	}
+
+	spec := os.Getenv("PASSWORD_PEPPERS")
+	if spec == "" {
+		return encrypter, nil
+	}
+
+	peppers, err := encryption.ParsePeppers(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := os.Getenv("PASSWORD_PEPPER_ID")
+	if _, ok := peppers[keyID]; !ok {
+		return nil, fmt.Errorf("PASSWORD_PEPPER_ID %q: %w", keyID, encryption.ErrUnknownPepper)
+	}
+
+	return &encryption.PepperedEncrypter{Encrypter: encrypter, Peppers: peppers, CurrentKeyID: keyID}, nil
+}
+
+// newPasswordPolicy extends the default policy with the breached passwords
+// listed in BREACHED_PASSWORDS_FILE, when set
+func newPasswordPolicy() (*user.PasswordPolicy, error) {
+	policy := *user.DefaultPasswordPolicy
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := user.LoadBreachedPasswords(path)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+	}
+
+	return &policy, nil
+}
+
+// newMailer sends through the SMTP server at SMTP_ADDR when set, otherwise
+// writes messages to MAIL_DIR (./mail by default)
+func newMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "noreply@localhost"
+	}
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return &mailer.SMTPMailer{Addr: addr, From: from, Username: os.Getenv("SMTP_USERNAME"), Password: os.Getenv("SMTP_PASSWORD")}
+	}
+
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+	return &mailer.FileMailer{Dir: dir, From: from}
+}
+
+// newOIDCProvider signs users in through the OpenID Connect provider at
+// OIDC_ISSUER, or returns nil when it isn't set
+func newOIDCProvider() *user.OIDCProvider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = baseURL() + "/users/oidc/callback"
+	}
+
+	return &user.OIDCProvider{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+	}
+}
+
+// baseURL is the public address used in emailed links, BASE_URL or localhost
+func baseURL() string {
+	if url := os.Getenv("BASE_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:5000"
+}
@@ -0,0 +1,163 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrUnknownKey delivered when no key of a set matches the token's key ID
+var ErrUnknownKey = errors.New("Unknown signing key")
+
+// JWK public JSON Web Key (RFC 7517) for RSA and P-256 ECDSA keys
+type JWK struct {
+	KeyType   string    `json:"kty"`
+	KeyID     string    `json:"kid,omitempty"`
+	Use       string    `json:"use,omitempty"`
+	Algorithm Algorithm `json:"alg,omitempty"`
+	N         string    `json:"n,omitempty"`
+	E         string    `json:"e,omitempty"`
+	Curve     string    `json:"crv,omitempty"`
+	X         string    `json:"x,omitempty"`
+	Y         string    `json:"y,omitempty"`
+}
+
+// JWKS set of public keys, as published by identity providers
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes an RSA or P-256 public key as a signing JWK named kid
+func NewJWK(kid string, publicKey crypto.PublicKey) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: RS256,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return JWK{}, errors.New("only P-256 ECDSA keys are supported")
+		}
+		coordinates := make([]byte, 64)
+		key.X.FillBytes(coordinates[:32])
+		key.Y.FillBytes(coordinates[32:])
+		return JWK{
+			KeyType:   "EC",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: ES256,
+			Curve:     "P-256",
+			X:         base64.RawURLEncoding.EncodeToString(coordinates[:32]),
+			Y:         base64.RawURLEncoding.EncodeToString(coordinates[32:]),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported public key %T", publicKey)
+}
+
+// Thumbprint identifies the key by the SHA-256 of its required members (RFC 7638),
+// the same key always gets the same thumbprint
+func (k JWK) Thumbprint() string {
+	var members string
+	switch k.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Curve, k.X, k.Y)
+	}
+	digest := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// PublicKey delivers the RSA or ECDSA public key the JWK describes
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+		e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+		if nErr != nil || eErr != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		x, xErr := base64.RawURLEncoding.DecodeString(k.X)
+		y, yErr := base64.RawURLEncoding.DecodeString(k.Y)
+		if k.Curve != "P-256" || xErr != nil || yErr != nil {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// Verify checks the token's signature with the key named by its header and
+// decodes its claims into claims. Only RS256 and ES256 are accepted; expiry,
+// issuer and audience are left to the caller since they differ per token
+func (s JWKS) Verify(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return ErrInvalidToken
+	}
+
+	if h.Algorithm != RS256 && h.Algorithm != ES256 {
+		return ErrUnexpectedAlgorithm
+	}
+
+	key, err := s.find(h.KeyID)
+	if err != nil {
+		return err
+	}
+
+	if key.Algorithm != "" && key.Algorithm != h.Algorithm {
+		return ErrUnexpectedAlgorithm
+	}
+
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !validPublicKeySignature(h.Algorithm, publicKey, parts[0]+"."+parts[1], signature) {
+		return ErrInvalidToken
+	}
+
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// find delivers the key named kid, or the only key of the set when the token names none
+func (s JWKS) find(kid string) (JWK, error) {
+	if kid == "" && len(s.Keys) == 1 {
+		return s.Keys[0], nil
+	}
+
+	for _, key := range s.Keys {
+		if key.KeyID == kid && kid != "" && (key.Use == "" || key.Use == "sig") {
+			return key, nil
+		}
+	}
+	return JWK{}, ErrUnknownKey
+}
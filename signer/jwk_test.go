@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWK(t *testing.T) {
+	t.Run("Describes RSA and P-256 public keys and reads them back", func(t *testing.T) {
+		rsaKey := makeRS256(t).PublicKey
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		for _, publicKey := range []interface{}{rsaKey, &ecKey.PublicKey} {
+			jwk, err := NewJWK("any-kid", publicKey)
+			assertNoError(t, err)
+
+			data, _ := json.Marshal(jwk)
+			var decoded JWK
+			json.Unmarshal(data, &decoded)
+
+			got, err := decoded.PublicKey()
+			assertNoError(t, err)
+
+			if !reflect.DeepEqual(got, publicKey) {
+				t.Errorf("got %v, want %v", got, publicKey)
+			}
+		}
+	})
+
+	t.Run("Delivers error for points off the curve", func(t *testing.T) {
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		jwk, _ := NewJWK("any-kid", &ecKey.PublicKey)
+		jwk.Y = jwk.X
+
+		if _, err := jwk.PublicKey(); err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example key and thumbprint from RFC 7638 section 3.1
+	jwk := JWK{
+		KeyType: "RSA",
+		KeyID:   "2011-04-29",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn" +
+			"64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOp" +
+			"bISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+
+	assertString(t, jwk.Thumbprint(), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+}
+
+func TestJWKSVerify(t *testing.T) {
+	makeKeySet := func(t *testing.T) (*JWT, JWKS) {
+		sut := makeRS256(t)
+		sut.KeyID = "current"
+		jwk, _ := NewJWK("current", sut.PublicKey)
+		return sut, JWKS{Keys: []JWK{jwk}}
+	}
+
+	t.Run("Decodes claims of tokens signed by a key of the set", func(t *testing.T) {
+		sut, keys := makeKeySet(t)
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		var claims Claims
+		err := keys.Verify(token, &claims)
+
+		assertNoError(t, err)
+		if claims.Subject != "any@mail.com" {
+			t.Errorf("got %q, want %q", claims.Subject, "any@mail.com")
+		}
+	})
+
+	t.Run("Delivers ErrUnknownKey for keys missing from the set", func(t *testing.T) {
+		sut, keys := makeKeySet(t)
+		sut.KeyID = "rotated"
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		if err := keys.Verify(token, &Claims{}); err != ErrUnknownKey {
+			t.Errorf("got %v, want %v", err, ErrUnknownKey)
+		}
+	})
+
+	t.Run("Rejects HMAC tokens and tampered tokens", func(t *testing.T) {
+		sut, keys := makeKeySet(t)
+		hs := makeHS256(t)
+		hmacToken, _ := hs.Sign(Claims{Subject: "any@mail.com"})
+
+		if err := keys.Verify(hmacToken, &Claims{}); err != ErrUnexpectedAlgorithm {
+			t.Errorf("got %v, want %v", err, ErrUnexpectedAlgorithm)
+		}
+
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		parts := strings.Split(token, ".")
+		forged, _ := encodeSegment(Claims{Subject: "admin@mail.com"})
+
+		if err := keys.Verify(parts[0]+"."+forged+"."+parts[2], &Claims{}); err != ErrInvalidToken {
+			t.Errorf("got %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("Rejects tokens whose algorithm doesn't match the key", func(t *testing.T) {
+		_, keys := makeKeySet(t)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		es := &JWT{Algorithm: ES256, KeyID: "current", PrivateKey: ecKey, PublicKey: &ecKey.PublicKey, TTL: time.Hour}
+		token, _ := es.Sign(Claims{Subject: "any@mail.com"})
+
+		if err := keys.Verify(token, &Claims{}); err != ErrUnexpectedAlgorithm {
+			t.Errorf("got %v, want %v", err, ErrUnexpectedAlgorithm)
+		}
+	})
+}
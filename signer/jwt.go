@@ -0,0 +1,450 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Algorithm used to sign a JWT
+type Algorithm string
+
+// Supported JWT algorithms
+const (
+	HS256 Algorithm = "HS256"
+	RS256 Algorithm = "RS256"
+	ES256 Algorithm = "ES256"
+)
+
+// ErrInvalidToken delivered for malformed or tampered tokens
+var ErrInvalidToken = errors.New("Invalid token")
+
+// ErrExpiredToken delivered for tokens past their expiry
+var ErrExpiredToken = errors.New("Expired token")
+
+// ErrRevokedToken delivered for tokens found in the revocation list
+var ErrRevokedToken = errors.New("Revoked token")
+
+// ErrUnexpectedAlgorithm delivered when the token header names another algorithm
+var ErrUnexpectedAlgorithm = errors.New("Unexpected token algorithm")
+
+// ErrNoPublicKey delivered when publishing the keys of an HMAC signed JWT
+var ErrNoPublicKey = errors.New("HS256 tokens have no public key")
+
+// JWT signs and verifies JSON Web Tokens with a single algorithm, naming KeyID in
+// the header when set and rejecting tokens in Revocations when one is set.
+// Tokens naming one of PreviousKeys still verify, so keys can be rotated
+// without logging everyone out. Issuer is set as iss on signed tokens and
+// Audience as aud on access tokens only. Access tokens are typed at+jwt and
+// single purpose ones after their purpose, so verifiers checking typ or aud
+// can't take one for the other
+type JWT struct {
+	Algorithm    Algorithm
+	KeyID        string
+	Issuer       string
+	Audience     string
+	Secret       []byte
+	PrivateKey   crypto.Signer
+	PublicKey    crypto.PublicKey
+	PreviousKeys []JWK
+	TTL          time.Duration
+	Revocations  RevocationList
+	now          func() time.Time
+}
+
+// AccessTokenType typ header of access tokens (RFC 9068)
+const AccessTokenType = "at+jwt"
+
+// legacyTokenType typ header of tokens signed before they were typed
+const legacyTokenType = "JWT"
+
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ"`
+	KeyID     string    `json:"kid,omitempty"`
+}
+
+// NewHS256 creates a JWT signed with an HMAC secret
+func NewHS256(secret []byte, ttl time.Duration) (*JWT, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("HS256 requires a non empty secret")
+	}
+	return &JWT{Algorithm: HS256, Secret: secret, TTL: ttl}, nil
+}
+
+// NewRS256 creates a JWT signed with the RSA private key in a PEM file, named by its thumbprint
+func NewRS256(keyFile string, ttl time.Duration) (*JWT, error) {
+	key, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA private key", keyFile)
+	}
+	return newPublicKeyJWT(RS256, rsaKey, ttl)
+}
+
+// NewES256 creates a JWT signed with the P-256 ECDSA private key in a PEM file, named by its thumbprint
+func NewES256(keyFile string, ttl time.Duration) (*JWT, error) {
+	key, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s is not a P-256 ECDSA private key", keyFile)
+	}
+	return newPublicKeyJWT(ES256, ecKey, ttl)
+}
+
+func newPublicKeyJWT(algorithm Algorithm, key crypto.Signer, ttl time.Duration) (*JWT, error) {
+	jwk, err := NewJWK("", key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &JWT{Algorithm: algorithm, KeyID: jwk.Thumbprint(), PrivateKey: key, PublicKey: key.Public(), TTL: ttl}, nil
+}
+
+// AddPreviousKey keeps accepting tokens signed with the key in a PEM file, public or
+// private, after rotating to a new one. It is named by its thumbprint like new keys
+func (j *JWT) AddPreviousKey(keyFile string) error {
+	publicKey, err := loadPublicKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	jwk, err := NewJWK("", publicKey)
+	if err != nil {
+		return err
+	}
+
+	if jwk.Algorithm != j.Algorithm {
+		return fmt.Errorf("%s is not a %s key", keyFile, j.Algorithm)
+	}
+
+	jwk.KeyID = jwk.Thumbprint()
+	j.PreviousKeys = append(j.PreviousKeys, jwk)
+	return nil
+}
+
+// JWKS delivers the current public key followed by the previous ones
+func (j *JWT) JWKS() (JWKS, error) {
+	if j.Algorithm == HS256 {
+		return JWKS{}, ErrNoPublicKey
+	}
+
+	current, err := NewJWK(j.KeyID, j.PublicKey)
+	if err != nil {
+		return JWKS{}, err
+	}
+	return JWKS{Keys: append([]JWK{current}, j.PreviousKeys...)}, nil
+}
+
+// Sign fills issued-at, expiry and token ID when missing and delivers the signed token
+func (j *JWT) Sign(claims Claims) (string, error) {
+	now := j.clock()
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = unixSeconds(now)
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = now.Add(j.TTL).Unix()
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = j.Issuer
+	}
+	if claims.Audience == "" && claims.Purpose == "" {
+		claims.Audience = j.Audience
+	}
+	if claims.ID == "" {
+		id, err := newTokenID()
+		if err != nil {
+			return "", err
+		}
+		claims.ID = id
+	}
+
+	encodedHeader, err := encodeSegment(header{Algorithm: j.Algorithm, Type: TokenType(claims), KeyID: j.KeyID})
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodedHeader + "." + encodedClaims
+	signature, err := j.signature(signingInput)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks algorithm, signature and expiry before delivering the token claims
+func (j *JWT) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if h.Algorithm != j.Algorithm {
+		return Claims{}, ErrUnexpectedAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !j.validSignature(h.KeyID, parts[0]+"."+parts[1], signature) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	// Tokens signed before an issuer, audience or type was configured carry none and remain valid
+	if claims.Issuer != "" && claims.Issuer != j.Issuer {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if h.Type != legacyTokenType && h.Type != TokenType(claims) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if claims.Purpose == "" && claims.Audience != "" && claims.Audience != j.Audience {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if j.clock().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+
+	if j.Revocations != nil {
+		revoked, err := j.Revocations.IsRevoked(claims)
+		if err != nil {
+			return Claims{}, err
+		}
+		if revoked {
+			return Claims{}, ErrRevokedToken
+		}
+	}
+
+	return claims, nil
+}
+
+// Revoke rejects the token the claims were verified from until it expires. Without
+// Revocations nothing is checked on Verify, so there is nothing to remember
+func (j *JWT) Revoke(claims Claims) error {
+	if j.Revocations == nil {
+		return nil
+	}
+	return j.Revocations.Revoke(claims.ID, time.Unix(claims.ExpiresAt, 0))
+}
+
+// RevokeSubject rejects every token issued to subject so far, remembering it
+// only while those tokens could still be valid
+func (j *JWT) RevokeSubject(subject string) error {
+	if j.Revocations == nil {
+		return nil
+	}
+	now := j.clock()
+	return j.Revocations.RevokeSubject(subject, now, now.Add(j.TTL))
+}
+
+// TokenType delivers the typ header of tokens with claims, at+jwt for access tokens
+// and the purpose for single purpose ones, e.g. mfa-pending+jwt
+func TokenType(claims Claims) string {
+	if claims.Purpose == "" {
+		return AccessTokenType
+	}
+	return claims.Purpose + "+jwt"
+}
+
+// unixSeconds delivers t as a NumericDate, seconds since the epoch with fractions
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (j *JWT) signature(signingInput string) ([]byte, error) {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch j.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, j.Secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case RS256:
+		key, ok := j.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires an RSA private key")
+		}
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case ES256:
+		key, ok := j.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("ES256 requires an ECDSA private key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", j.Algorithm)
+}
+
+// validSignature checks the signature with the current key, or the previous key named by keyID
+func (j *JWT) validSignature(keyID string, signingInput string, signature []byte) bool {
+	if j.Algorithm == HS256 {
+		mac := hmac.New(sha256.New, j.Secret)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(signature, mac.Sum(nil))
+	}
+
+	publicKey := j.PublicKey
+	if keyID != "" && keyID != j.KeyID {
+		previous, err := JWKS{Keys: j.PreviousKeys}.find(keyID)
+		if err != nil {
+			return false
+		}
+		if publicKey, err = previous.PublicKey(); err != nil {
+			return false
+		}
+	}
+	return validPublicKeySignature(j.Algorithm, publicKey, signingInput, signature)
+}
+
+// validPublicKeySignature checks RS256 and ES256 signatures, the key type must match the algorithm
+func validPublicKeySignature(algorithm Algorithm, publicKey crypto.PublicKey, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch algorithm {
+	case RS256:
+		key, ok := publicKey.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ES256:
+		key, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	}
+	return false
+}
+
+func (j *JWT) clock() time.Time {
+	if j.now != nil {
+		return j.now()
+	}
+	return time.Now()
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func loadPrivateKey(keyFile string) (crypto.Signer, error) {
+	block, err := loadPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey(keyFile, block)
+}
+
+// loadPublicKey reads a PKIX public key, or the public half of a private key
+func loadPublicKey(keyFile string) (crypto.PublicKey, error) {
+	block, err := loadPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := parsePrivateKey(keyFile, block)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public(), nil
+}
+
+func loadPEM(keyFile string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", keyFile)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(keyFile string, block *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%s does not contain a supported private key", keyFile)
+}
@@ -0,0 +1,353 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWT(t *testing.T) {
+	t.Run("Delivers signed claims on verify", func(t *testing.T) {
+		sut := makeHS256(t)
+
+		token, err := sut.Sign(Claims{Subject: "any@mail.com", Name: "any-name"})
+		assertNoError(t, err)
+
+		got, err := sut.Verify(token)
+		assertNoError(t, err)
+
+		assertString(t, got.Subject, "any@mail.com")
+		assertString(t, got.Name, "any-name")
+	})
+
+	t.Run("Fills issued-at, expiry and token ID", func(t *testing.T) {
+		sut := makeHS256(t)
+		now := time.Unix(1000, 0)
+		sut.now = func() time.Time { return now }
+
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		got, _ := sut.Verify(token)
+
+		if got.IssuedAt != 1000 || got.ExpiresAt != 1000+int64(time.Hour.Seconds()) {
+			t.Errorf("got iat %v exp %d, want 1000 and 4600", got.IssuedAt, got.ExpiresAt)
+		}
+
+		if got.ID == "" {
+			t.Errorf("got empty token ID, want generated one")
+		}
+	})
+
+	t.Run("Generates a different token ID for every token", func(t *testing.T) {
+		sut := makeHS256(t)
+
+		first, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		second, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		firstClaims, _ := sut.Verify(first)
+		secondClaims, _ := sut.Verify(second)
+
+		if firstClaims.ID == secondClaims.ID {
+			t.Errorf("got repeated token ID %q", firstClaims.ID)
+		}
+	})
+
+	t.Run("Rejects expired token", func(t *testing.T) {
+		sut := makeHS256(t)
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		sut.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+		_, err := sut.Verify(token)
+
+		assertErr(t, err, ErrExpiredToken)
+	})
+
+	t.Run("Rejects tampered claims", func(t *testing.T) {
+		sut := makeHS256(t)
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		parts := strings.Split(token, ".")
+		forged, _ := encodeSegment(Claims{Subject: "admin@mail.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+		_, err := sut.Verify(parts[0] + "." + forged + "." + parts[2])
+
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Rejects token signed with another secret", func(t *testing.T) {
+		other, _ := NewHS256([]byte("other-secret"), time.Hour)
+		token, _ := other.Sign(Claims{Subject: "any@mail.com"})
+
+		_, err := makeHS256(t).Verify(token)
+
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Rejects malformed token", func(t *testing.T) {
+		_, err := makeHS256(t).Verify("not-a-token")
+
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Rejects unsigned token", func(t *testing.T) {
+		sut := makeHS256(t)
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		parts := strings.Split(token, ".")
+		none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+		_, err := sut.Verify(none + "." + parts[1] + ".")
+
+		assertErr(t, err, ErrUnexpectedAlgorithm)
+	})
+
+	t.Run("Rejects HS256 token when expecting RS256", func(t *testing.T) {
+		rs := makeRS256(t)
+		hs := makeHS256(t)
+		token, _ := hs.Sign(Claims{Subject: "any@mail.com"})
+
+		_, err := rs.Verify(token)
+
+		assertErr(t, err, ErrUnexpectedAlgorithm)
+	})
+
+	t.Run("Sets the issuer and rejects tokens from another", func(t *testing.T) {
+		sut := makeHS256(t)
+		sut.Issuer = "https://api.example.com"
+		other := makeHS256(t)
+		other.Issuer = "https://other.example.com"
+
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		got, err := sut.Verify(token)
+		assertNoError(t, err)
+		assertString(t, got.Issuer, "https://api.example.com")
+
+		foreign, _ := other.Sign(Claims{Subject: "any@mail.com"})
+		_, err = sut.Verify(foreign)
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Types access and single purpose tokens apart", func(t *testing.T) {
+		sut := makeHS256(t)
+
+		access, _ := sut.Sign(Claims{Subject: "any-id"})
+		mfa, _ := sut.Sign(Claims{Subject: "any@mail.com", Purpose: "mfa-pending"})
+
+		assertString(t, tokenHeader(t, access).Type, AccessTokenType)
+		assertString(t, tokenHeader(t, mfa).Type, "mfa-pending+jwt")
+	})
+
+	t.Run("Sets the audience on access tokens only and rejects tokens for another", func(t *testing.T) {
+		sut := makeHS256(t)
+		sut.Audience = "https://api.example.com"
+
+		access, _ := sut.Sign(Claims{Subject: "any-id"})
+		mfa, _ := sut.Sign(Claims{Subject: "any@mail.com", Purpose: "mfa-pending"})
+		foreign, _ := sut.Sign(Claims{Subject: "any-id", Audience: "https://other.example.com"})
+
+		got, err := sut.Verify(access)
+		assertNoError(t, err)
+		assertString(t, got.Audience, "https://api.example.com")
+
+		got, err = sut.Verify(mfa)
+		assertNoError(t, err)
+		assertString(t, got.Audience, "")
+
+		_, err = sut.Verify(foreign)
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Rejects tokens typed for another purpose", func(t *testing.T) {
+		sut := makeHS256(t)
+		mfa, _ := sut.Sign(Claims{Subject: "any@mail.com", Purpose: "mfa-pending"})
+		parts := strings.Split(mfa, ".")
+		retyped, _ := encodeSegment(header{Algorithm: HS256, Type: AccessTokenType})
+		signature, _ := sut.signature(retyped + "." + parts[1])
+
+		_, err := sut.Verify(retyped + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(signature))
+
+		assertErr(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Delivers error on empty HS256 secret", func(t *testing.T) {
+		_, err := NewHS256(nil, time.Hour)
+
+		if err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+func TestJWTKeyFiles(t *testing.T) {
+	t.Run("Signs and verifies with RS256 key file", func(t *testing.T) {
+		assertRoundTrip(t, makeRS256(t))
+	})
+
+	t.Run("Signs and verifies with ES256 key file", func(t *testing.T) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalECPrivateKey(key)
+
+		sut, err := NewES256(writePEM(t, "EC PRIVATE KEY", der), time.Hour)
+		assertNoError(t, err)
+
+		assertRoundTrip(t, sut)
+	})
+
+	t.Run("Delivers error when key type does not match algorithm", func(t *testing.T) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalECPrivateKey(key)
+
+		_, err := NewRS256(writePEM(t, "EC PRIVATE KEY", der), time.Hour)
+
+		if err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+
+	t.Run("Delivers error on missing key file", func(t *testing.T) {
+		_, err := NewES256(filepath.Join(t.TempDir(), "missing.pem"), time.Hour)
+
+		if err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	t.Run("Names tokens by the key thumbprint", func(t *testing.T) {
+		sut := makeRS256(t)
+		jwk, _ := NewJWK("", sut.PublicKey)
+
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		var h header
+		decodeSegment(strings.Split(token, ".")[0], &h)
+		assertString(t, h.KeyID, jwk.Thumbprint())
+	})
+
+	t.Run("Verifies tokens of previous keys after rotating", func(t *testing.T) {
+		previous := makeRS256(t)
+		token, _ := previous.Sign(Claims{Subject: "any@mail.com"})
+		der, _ := x509.MarshalPKIXPublicKey(previous.PublicKey)
+		sut := makeRS256(t)
+
+		_, err := sut.Verify(token)
+		assertErr(t, err, ErrInvalidToken)
+
+		assertNoError(t, sut.AddPreviousKey(writePEM(t, "PUBLIC KEY", der)))
+		got, err := sut.Verify(token)
+		assertNoError(t, err)
+		assertString(t, got.Subject, "any@mail.com")
+	})
+
+	t.Run("Delivers error for previous keys of another algorithm", func(t *testing.T) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalECPrivateKey(key)
+
+		err := makeRS256(t).AddPreviousKey(writePEM(t, "EC PRIVATE KEY", der))
+
+		if err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+
+	t.Run("Publishes the current key followed by previous ones", func(t *testing.T) {
+		previous := makeRS256(t)
+		der, _ := x509.MarshalPKIXPublicKey(previous.PublicKey)
+		sut := makeRS256(t)
+		sut.AddPreviousKey(writePEM(t, "PUBLIC KEY", der))
+
+		got, err := sut.JWKS()
+		assertNoError(t, err)
+
+		if len(got.Keys) != 2 {
+			t.Fatalf("got %d keys, want 2", len(got.Keys))
+		}
+		assertString(t, got.Keys[0].KeyID, sut.KeyID)
+		assertString(t, got.Keys[1].KeyID, previous.KeyID)
+	})
+
+	t.Run("Delivers ErrNoPublicKey for HS256", func(t *testing.T) {
+		_, err := makeHS256(t).JWKS()
+
+		assertErr(t, err, ErrNoPublicKey)
+	})
+}
+
+func tokenHeader(t *testing.T, token string) header {
+	t.Helper()
+	var h header
+	if err := decodeSegment(strings.Split(token, ".")[0], &h); err != nil {
+		t.Fatalf("got %v, want token header", err)
+	}
+	return h
+}
+
+func makeHS256(t *testing.T) *JWT {
+	t.Helper()
+	sut, err := NewHS256([]byte("any-secret"), time.Hour)
+	assertNoError(t, err)
+	return sut
+}
+
+func makeRS256(t *testing.T) *JWT {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	sut, err := NewRS256(writePEM(t, "PRIVATE KEY", der), time.Hour)
+	assertNoError(t, err)
+	return sut
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Unable to write key file: %v", err)
+	}
+	return path
+}
+
+func assertRoundTrip(t *testing.T, sut *JWT) {
+	t.Helper()
+	token, err := sut.Sign(Claims{Subject: "any@mail.com"})
+	assertNoError(t, err)
+
+	got, err := sut.Verify(token)
+	assertNoError(t, err)
+	assertString(t, got.Subject, "any@mail.com")
+
+	parts := strings.Split(token, ".")
+	_, err = sut.Verify(parts[0] + "." + parts[1] + "." + parts[2][:len(parts[2])-4] + "AAAA")
+	assertErr(t, err, ErrInvalidToken)
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func assertErr(t *testing.T, got error, want error) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func assertString(t *testing.T, got string, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package signer
+
+import "testing"
+
+func TestOpaqueToken(t *testing.T) {
+	t.Run("Delivers a different token on every call", func(t *testing.T) {
+		first, err := NewOpaqueToken()
+		assertNoError(t, err)
+		second, _ := NewOpaqueToken()
+
+		if first == "" || first == second {
+			t.Errorf("got %q and %q, want two distinct tokens", first, second)
+		}
+	})
+
+	t.Run("Hashes tokens deterministically without exposing them", func(t *testing.T) {
+		token, _ := NewOpaqueToken()
+
+		if HashToken(token) != HashToken(token) {
+			t.Errorf("got different hashes for the same token")
+		}
+
+		if HashToken(token) == token {
+			t.Errorf("got token itself, want its digest")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package signer
+
+import (
+	"sync"
+	"time"
+)
+
+// A RevocationList remembers revoked tokens until they would have expired anyway
+type RevocationList interface {
+	Revoke(id string, expiresAt time.Time) error
+	RevokeSubject(subject string, issuedUntil time.Time, expiresAt time.Time) error
+	IsRevoked(claims Claims) (bool, error)
+}
+
+// A Revoker may revoke a single token or every token issued for a subject so far
+type Revoker interface {
+	Revoke(claims Claims) error
+	RevokeSubject(subject string) error
+}
+
+type subjectRevocation struct {
+	issuedUntil time.Time
+	expiresAt   time.Time
+}
+
+// InMemoryRevocationList drops entries once they expire so it does not grow forever
+type InMemoryRevocationList struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+	now      func() time.Time
+}
+
+// Revoke rejects the token with the given ID until expiresAt
+func (i *InMemoryRevocationList) Revoke(id string, expiresAt time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.prune()
+
+	if i.tokens == nil {
+		i.tokens = map[string]time.Time{}
+	}
+	i.tokens[id] = expiresAt
+	return nil
+}
+
+// RevokeSubject rejects tokens of subject issued up to issuedUntil, until expiresAt
+func (i *InMemoryRevocationList) RevokeSubject(subject string, issuedUntil time.Time, expiresAt time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.prune()
+
+	if i.subjects == nil {
+		i.subjects = map[string]subjectRevocation{}
+	}
+	i.subjects[subject] = subjectRevocation{issuedUntil, expiresAt}
+	return nil
+}
+
+// IsRevoked delivers whether the token ID or its subject was revoked
+func (i *InMemoryRevocationList) IsRevoked(claims Claims) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.prune()
+
+	if _, ok := i.tokens[claims.ID]; ok {
+		return true, nil
+	}
+
+	revocation, ok := i.subjects[claims.Subject]
+	return ok && claims.IssuedAt <= unixSeconds(revocation.issuedUntil), nil
+}
+
+// Len delivers how many entries are still kept
+func (i *InMemoryRevocationList) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.prune()
+
+	return len(i.tokens) + len(i.subjects)
+}
+
+func (i *InMemoryRevocationList) prune() {
+	now := i.clock()
+	for id, expiresAt := range i.tokens {
+		if !now.Before(expiresAt) {
+			delete(i.tokens, id)
+		}
+	}
+	for subject, revocation := range i.subjects {
+		if !now.Before(revocation.expiresAt) {
+			delete(i.subjects, subject)
+		}
+	}
+}
+
+func (i *InMemoryRevocationList) clock() time.Time {
+	if i.now != nil {
+		return i.now()
+	}
+	return time.Now()
+}
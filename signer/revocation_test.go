@@ -0,0 +1,138 @@
+package signer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryRevocationList(t *testing.T) {
+	t.Run("Delivers revoked token IDs only", func(t *testing.T) {
+		sut := &InMemoryRevocationList{}
+		sut.Revoke("revoked", time.Now().Add(time.Hour))
+
+		assertRevoked(t, sut, Claims{ID: "revoked"}, true)
+		assertRevoked(t, sut, Claims{ID: "other"}, false)
+	})
+
+	t.Run("Revokes subject tokens issued up to the revocation only", func(t *testing.T) {
+		sut := &InMemoryRevocationList{}
+		revokedAt := time.Unix(1000, 0)
+		sut.RevokeSubject("any@mail.com", revokedAt, time.Now().Add(time.Hour))
+
+		assertRevoked(t, sut, Claims{Subject: "any@mail.com", IssuedAt: 999}, true)
+		assertRevoked(t, sut, Claims{Subject: "any@mail.com", IssuedAt: 1000}, true)
+		assertRevoked(t, sut, Claims{Subject: "any@mail.com", IssuedAt: 1001}, false)
+		assertRevoked(t, sut, Claims{Subject: "other@mail.com", IssuedAt: 999}, false)
+	})
+
+	t.Run("Tells apart tokens issued within the second of the revocation", func(t *testing.T) {
+		sut := &InMemoryRevocationList{}
+		sut.RevokeSubject("any@mail.com", time.Unix(1000, 500*int64(time.Millisecond)), time.Now().Add(time.Hour))
+
+		assertRevoked(t, sut, Claims{Subject: "any@mail.com", IssuedAt: 1000.25}, true)
+		assertRevoked(t, sut, Claims{Subject: "any@mail.com", IssuedAt: 1000.75}, false)
+	})
+
+	t.Run("Drops entries once the underlying tokens expire", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		sut := &InMemoryRevocationList{now: func() time.Time { return now }}
+		sut.Revoke("token", time.Unix(1100, 0))
+		sut.RevokeSubject("any@mail.com", now, time.Unix(1200, 0))
+
+		if sut.Len() != 2 {
+			t.Fatalf("got %d entries, want 2", sut.Len())
+		}
+
+		now = time.Unix(1100, 0)
+		assertRevoked(t, sut, Claims{ID: "token"}, false)
+
+		now = time.Unix(1200, 0)
+		if sut.Len() != 0 {
+			t.Errorf("got %d entries, want 0", sut.Len())
+		}
+	})
+}
+
+func TestJWTRevocation(t *testing.T) {
+	t.Run("Rejects revoked token", func(t *testing.T) {
+		sut := makeHS256(t)
+		sut.Revocations = &InMemoryRevocationList{}
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		claims, _ := sut.Verify(token)
+
+		assertNoError(t, sut.Revoke(claims))
+		_, err := sut.Verify(token)
+
+		assertErr(t, err, ErrRevokedToken)
+	})
+
+	t.Run("Rejects every token previously issued to the subject", func(t *testing.T) {
+		sut := makeHS256(t)
+		sut.Revocations = &InMemoryRevocationList{}
+		first, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		second, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		other, _ := sut.Sign(Claims{Subject: "other@mail.com"})
+
+		assertNoError(t, sut.RevokeSubject("any@mail.com"))
+
+		for _, token := range []string{first, second} {
+			_, err := sut.Verify(token)
+			assertErr(t, err, ErrRevokedToken)
+		}
+
+		_, err := sut.Verify(other)
+		assertNoError(t, err)
+	})
+
+	t.Run("Accepts tokens issued right after revoking the subject", func(t *testing.T) {
+		now := time.Unix(1000, 200*int64(time.Millisecond))
+		sut := makeHS256(t)
+		sut.now = func() time.Time { return now }
+		sut.Revocations = &InMemoryRevocationList{now: sut.now}
+		old, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		now = now.Add(300 * time.Millisecond)
+		assertNoError(t, sut.RevokeSubject("any@mail.com"))
+		now = now.Add(time.Millisecond)
+		renewed, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+
+		_, err := sut.Verify(old)
+		assertErr(t, err, ErrRevokedToken)
+		_, err = sut.Verify(renewed)
+		assertNoError(t, err)
+	})
+
+	t.Run("Does nothing without a revocation list", func(t *testing.T) {
+		sut := makeHS256(t)
+		token, _ := sut.Sign(Claims{Subject: "any@mail.com"})
+		claims, _ := sut.Verify(token)
+
+		assertNoError(t, sut.Revoke(claims))
+		assertNoError(t, sut.RevokeSubject("any@mail.com"))
+	})
+
+	t.Run("Keeps subject revocation only as long as tokens live", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		list := &InMemoryRevocationList{now: func() time.Time { return now }}
+		sut := makeHS256(t)
+		sut.now = func() time.Time { return now }
+		sut.Revocations = list
+
+		sut.RevokeSubject("any@mail.com")
+
+		now = now.Add(time.Hour)
+		if list.Len() != 0 {
+			t.Errorf("got %d entries, want 0", list.Len())
+		}
+	})
+}
+
+func assertRevoked(t *testing.T, sut *InMemoryRevocationList, claims Claims, want bool) {
+	t.Helper()
+	got, err := sut.IsRevoked(claims)
+	assertNoError(t, err)
+
+	if got != want {
+		t.Errorf("got revoked %v for %+v, want %v", got, claims, want)
+	}
+}
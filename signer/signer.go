@@ -1,6 +1,34 @@
 package signer
 
+// Claims identifying the user a token was issued for and their role. Purpose is empty for
+// access tokens and names the flow for single purpose tokens such as email links.
+// IssuedAt keeps fractions of a second, so tokens issued right after a revocation
+// are told apart from the ones it revoked. AuthTime is when the user last signed in,
+// kept as tokens are refreshed. Audience names who access tokens are meant for
+type Claims struct {
+	Issuer    string  `json:"iss,omitempty"`
+	Audience  string  `json:"aud,omitempty"`
+	Subject   string  `json:"sub"`
+	Name      string  `json:"name,omitempty"`
+	Role      string  `json:"role,omitempty"`
+	Purpose   string  `json:"purpose,omitempty"`
+	IssuedAt  float64 `json:"iat"`
+	ExpiresAt int64   `json:"exp"`
+	AuthTime  int64   `json:"auth_time,omitempty"`
+	ID        string  `json:"jti"`
+}
+
 // A Signer may sign a user with a token
 type Signer interface {
-	Sign() (string, error)
+	Sign(claims Claims) (string, error)
+}
+
+// A Verifier may validate a token and deliver the claims it was signed with
+type Verifier interface {
+	Verify(token string) (Claims, error)
+}
+
+// A KeyPublisher may deliver the public keys its tokens can be verified with
+type KeyPublisher interface {
+	JWKS() (JWKS, error)
 }
@@ -0,0 +1,78 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultDeletionGrace used when Server.DeletionGrace is not set
+const DefaultDeletionGrace = 30 * 24 * time.Hour
+
+// DeleteAccountModel model struct
+type DeleteAccountModel struct {
+	Password string
+}
+
+// DeletionModel response struct with the time the account is removed for good
+type DeletionModel struct {
+	DeleteAt time.Time
+}
+
+// handleDeleteAccount schedules the authenticated user's account for deletion after
+// the grace period and revokes every session, logging in again cancels it
+func handleDeleteAccount(u *Server, w http.ResponseWriter, req *http.Request) {
+	current, _ := AuthenticatedUser(req.Context())
+
+	var deletion DeleteAccountModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&deletion)
+	}
+
+	if !reauthenticated(u, w, req, current, deletion.Password) {
+		return
+	}
+
+	grace := u.DeletionGrace
+	if grace == 0 {
+		grace = DefaultDeletionGrace
+	}
+	deleteAt := time.Now().Add(grace).UTC()
+
+	if err := u.Store.scheduleDeletion(current.Email, deleteAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := revokeAllSessions(u, current); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(DeletionModel{DeleteAt: deleteAt})
+}
+
+// PurgeDeletedAccounts removes the accounts whose grace period ended by now along
+// with all their data, delivering the first failure after trying every account
+func (u *Server) PurgeDeletedAccounts(now time.Time) error {
+	users, err := u.Store.getAll()
+	if err != nil {
+		return err
+	}
+
+	expired := []string{}
+	for _, user := range users {
+		if !user.deleteAt.IsZero() && !user.deleteAt.After(now) {
+			expired = append(expired, user.Email)
+		}
+	}
+
+	var firstErr error
+	for _, email := range expired {
+		if err := purgeUserData(u, email); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
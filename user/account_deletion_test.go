@@ -0,0 +1,198 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type PersonalDataSpy struct {
+	exported    interface{}
+	exportEmail string
+	transfers   [][2]string
+	purged      []string
+	defaultErr  error
+}
+
+func (p *PersonalDataSpy) ExportUserData(email string) (interface{}, error) {
+	p.exportEmail = email
+	return p.exported, p.defaultErr
+}
+
+func (p *PersonalDataSpy) TransferUserData(from string, to string) error {
+	p.transfers = append(p.transfers, [2]string{from, to})
+	return p.defaultErr
+}
+
+func (p *PersonalDataSpy) PurgeUserData(email string) error {
+	p.purged = append(p.purged, email)
+	return p.defaultErr
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Run("Delivers 422 status code on missing password", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me", `{}`)
+
+		want := ErrMissingParam("Password")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 403 on wrong password without scheduling", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		encrypter.compareError = errors.New("mismatch")
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me", `{"password": "wrong"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertString(t, store.deletionEmail, "")
+	})
+
+	t.Run("Accepts a recent sign in from users without password", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{ID: "any-id", Email: "email@mail.com", Verified: true}
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id", AuthTime: time.Now().Add(-time.Minute).Unix()}}
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me", `{}`)
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertString(t, store.deletionEmail, "email@mail.com")
+	})
+
+	t.Run("Delivers 403 to users without password who signed in too long ago", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{ID: "any-id", Email: "email@mail.com", Verified: true}
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id", AuthTime: time.Now().Add(-time.Hour).Unix()}}
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me", `{"password": ""}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrReauthRequired)
+		assertString(t, store.deletionEmail, "")
+	})
+
+	t.Run("Schedules deletion after the grace period and revokes sessions", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.DeletionGrace = time.Hour
+		store.foundUser = makeCurrentUser()
+		before := time.Now()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me", `{"password": "password123"}`)
+
+		var got DeletionModel
+		json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertString(t, store.deletionEmail, "email@mail.com")
+
+		if !store.deletionAt.Equal(got.DeleteAt) || got.DeleteAt.Before(before.Add(time.Hour)) || got.DeleteAt.After(time.Now().Add(time.Hour)) {
+			t.Errorf("got %v responded and %v stored, want an hour from now", got.DeleteAt, store.deletionAt)
+		}
+		assertCalls(t, len(sut.Revoker.(*RevokerSpy).revokedSubjects), 1)
+		assertCalls(t, len(store.deletedEmails), 0)
+	})
+
+	t.Run("Logging in during the grace period cancels the deletion", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", password: "hash", deleteAt: time.Now().Add(time.Hour)}
+		store.deletionAt = time.Now()
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, store.deletionEmail, "email@mail.com")
+
+		if !store.deletionAt.IsZero() {
+			t.Errorf("got %v, want deletion cancelled", store.deletionAt)
+		}
+	})
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	makePurgeSUT := func() (Server, *InMemoryUsersStore, *PersonalDataSpy) {
+		sut, _, _, _ := makeSUT(t)
+		store := &InMemoryUsersStore{Users: []DatabaseModel{
+			{Email: "expired@mail.com", deleteAt: time.Unix(500, 0)},
+			{Email: "grace@mail.com", deleteAt: time.Unix(2000, 0)},
+			{Email: "active@mail.com"},
+		}}
+		data := &PersonalDataSpy{}
+		sut.Store = store
+		sut.PersonalData = map[string]PersonalData{"foods": data}
+		return sut, store, data
+	}
+
+	t.Run("Removes expired accounts with all their data", func(t *testing.T) {
+		sut, store, data := makePurgeSUT()
+		saveRefreshToken(t, sut, RefreshToken{Hash: "a", Email: "expired@mail.com"})
+		saveRefreshToken(t, sut, RefreshToken{Hash: "b", Email: "grace@mail.com"})
+		saveResetToken(t, sut, PasswordResetToken{Hash: "c", Email: "expired@mail.com"})
+
+		err := sut.PurgeDeletedAccounts(time.Unix(1000, 0))
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		assertCalls(t, len(store.Users), 2)
+		if _, err := store.findByEmail("expired@mail.com"); err != ErrUserNotFound {
+			t.Errorf("got %v, want expired account removed", err)
+		}
+
+		assertCalls(t, len(data.purged), 1)
+		assertString(t, data.purged[0], "expired@mail.com")
+
+		sessions, _ := sut.RefreshTokens.findRefreshTokensByEmail("expired@mail.com")
+		resets, _ := sut.PasswordResets.findResetTokensByEmail("expired@mail.com")
+		kept, _ := sut.RefreshTokens.findRefreshTokensByEmail("grace@mail.com")
+		assertCalls(t, len(sessions), 0)
+		assertCalls(t, len(resets), 0)
+		assertCalls(t, len(kept), 1)
+	})
+
+	t.Run("Removes consecutive expired accounts", func(t *testing.T) {
+		sut, store, _ := makePurgeSUT()
+		store.Users = []DatabaseModel{
+			{Email: "a@mail.com", deleteAt: time.Unix(500, 0)},
+			{Email: "b@mail.com", deleteAt: time.Unix(600, 0)},
+			{Email: "active@mail.com"},
+		}
+
+		if err := sut.PurgeDeletedAccounts(time.Unix(1000, 0)); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		assertCalls(t, len(store.Users), 1)
+		assertString(t, store.Users[0].Email, "active@mail.com")
+	})
+
+	t.Run("Skips the stores that are not configured", func(t *testing.T) {
+		sut, store, _ := makePurgeSUT()
+		sut.PasswordResets = nil
+
+		if err := sut.PurgeDeletedAccounts(time.Unix(1000, 0)); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		assertCalls(t, len(store.Users), 2)
+	})
+
+	t.Run("Keeps the account when its data cannot be purged", func(t *testing.T) {
+		sut, store, data := makePurgeSUT()
+		data.defaultErr = errors.New("any-error")
+
+		err := sut.PurgeDeletedAccounts(time.Unix(1000, 0))
+
+		if err != data.defaultErr {
+			t.Errorf("got %v, want %v", err, data.defaultErr)
+		}
+		assertCalls(t, len(store.Users), 3)
+	})
+}
@@ -0,0 +1,121 @@
+package user
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrAPIKeyNotFound delivered by stores when no API key matches the lookup
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKey long lived credential of a user limited to Scopes, stored by hash.
+// Prefix is the start of the key, enough for owners to tell keys apart
+type APIKey struct {
+	ID         string
+	Name       string
+	Email      string `json:"-"`
+	Prefix     string
+	Hash       string `json:"-"`
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time `json:",omitempty"`
+	LastUsedAt *time.Time `json:",omitempty"`
+	Revoked    bool
+}
+
+// APIKeyStore API key store interface
+type APIKeyStore interface {
+	saveAPIKey(key APIKey) error
+	findAPIKey(hash string) (APIKey, error)
+	findAPIKeysByEmail(email string) ([]APIKey, error)
+	touchAPIKey(hash string, usedAt time.Time) error
+	revokeAPIKey(email string, id string) error
+	revokeAllAPIKeys(email string) error
+	purgeAPIKeys(email string) error
+}
+
+// InMemoryAPIKeyStore storage, safe for concurrent use
+type InMemoryAPIKeyStore struct {
+	mu   sync.Mutex
+	Keys []APIKey
+}
+
+func (i *InMemoryAPIKeyStore) saveAPIKey(key APIKey) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Keys = append(i.Keys, key)
+	return nil
+}
+
+func (i *InMemoryAPIKeyStore) findAPIKey(hash string) (APIKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, key := range i.Keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrAPIKeyNotFound
+}
+
+func (i *InMemoryAPIKeyStore) findAPIKeysByEmail(email string) ([]APIKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	keys := []APIKey{}
+	for _, key := range i.Keys {
+		if key.Email == email {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (i *InMemoryAPIKeyStore) touchAPIKey(hash string, usedAt time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Keys {
+		if i.Keys[index].Hash == hash {
+			i.Keys[index].LastUsedAt = &usedAt
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// revokeAPIKey only matches keys of email, so users can't revoke each other's keys
+func (i *InMemoryAPIKeyStore) revokeAPIKey(email string, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Keys {
+		if i.Keys[index].ID == id && i.Keys[index].Email == email {
+			i.Keys[index].Revoked = true
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (i *InMemoryAPIKeyStore) revokeAllAPIKeys(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Keys {
+		if i.Keys[index].Email == email {
+			i.Keys[index].Revoked = true
+		}
+	}
+	return nil
+}
+
+func (i *InMemoryAPIKeyStore) purgeAPIKeys(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	kept := i.Keys[:0]
+	for _, key := range i.Keys {
+		if key.Email != email {
+			kept = append(kept, key)
+		}
+	}
+	i.Keys = kept
+	return nil
+}
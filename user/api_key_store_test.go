@@ -0,0 +1,75 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryAPIKeyStore(t *testing.T) {
+	t.Run("Finds keys by hash and by owner", func(t *testing.T) {
+		store := InMemoryAPIKeyStore{}
+		store.saveAPIKey(APIKey{ID: "a", Hash: "hash-a", Email: "any@mail.com"})
+		store.saveAPIKey(APIKey{ID: "b", Hash: "hash-b", Email: "other@mail.com"})
+
+		got, err := store.findAPIKey("hash-b")
+		if err != nil || got.ID != "b" {
+			t.Errorf("got %v and %v, want key b", got, err)
+		}
+
+		if _, err := store.findAPIKey("unknown"); err != ErrAPIKeyNotFound {
+			t.Errorf("got %v, want %v", err, ErrAPIKeyNotFound)
+		}
+
+		owned, _ := store.findAPIKeysByEmail("any@mail.com")
+		if len(owned) != 1 || owned[0].ID != "a" {
+			t.Errorf("got %v, want key a", owned)
+		}
+	})
+
+	t.Run("Only revokes keys of the given owner", func(t *testing.T) {
+		store := InMemoryAPIKeyStore{}
+		store.saveAPIKey(APIKey{ID: "a", Hash: "hash-a", Email: "any@mail.com"})
+
+		if err := store.revokeAPIKey("other@mail.com", "a"); err != ErrAPIKeyNotFound {
+			t.Errorf("got %v, want %v", err, ErrAPIKeyNotFound)
+		}
+
+		store.revokeAPIKey("any@mail.com", "a")
+		got, _ := store.findAPIKey("hash-a")
+		if !got.Revoked {
+			t.Errorf("got %v, want revoked", got)
+		}
+	})
+
+	t.Run("Revokes every key of the given owner only", func(t *testing.T) {
+		store := InMemoryAPIKeyStore{}
+		store.saveAPIKey(APIKey{ID: "a", Hash: "hash-a", Email: "any@mail.com"})
+		store.saveAPIKey(APIKey{ID: "b", Hash: "hash-b", Email: "any@mail.com"})
+		store.saveAPIKey(APIKey{ID: "c", Hash: "hash-c", Email: "other@mail.com"})
+
+		store.revokeAllAPIKeys("any@mail.com")
+
+		for hash, want := range map[string]bool{"hash-a": true, "hash-b": true, "hash-c": false} {
+			if got, _ := store.findAPIKey(hash); got.Revoked != want {
+				t.Errorf("got %v for %q, want revoked %v", got.Revoked, hash, want)
+			}
+		}
+	})
+
+	t.Run("Records last use and purges by owner", func(t *testing.T) {
+		store := InMemoryAPIKeyStore{}
+		store.saveAPIKey(APIKey{ID: "a", Hash: "hash-a", Email: "any@mail.com"})
+		store.saveAPIKey(APIKey{ID: "b", Hash: "hash-b", Email: "other@mail.com"})
+		usedAt := time.Unix(1000, 0)
+
+		store.touchAPIKey("hash-a", usedAt)
+		got, _ := store.findAPIKey("hash-a")
+		if got.LastUsedAt == nil || !got.LastUsedAt.Equal(usedAt) {
+			t.Errorf("got %v, want %v", got.LastUsedAt, usedAt)
+		}
+
+		store.purgeAPIKeys("any@mail.com")
+		assertCalls(t, len(store.Keys), 1)
+		assertString(t, store.Keys[0].ID, "b")
+	})
+}
@@ -0,0 +1,184 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidScope error const
+const ErrInvalidScope = "Invalid scope"
+
+// ErrAPIKeysNotConfigured error const
+const ErrAPIKeysNotConfigured = "API keys are not configured"
+
+// ErrInvalidExpiry error const
+const ErrInvalidExpiry = "Expiry must be in the future"
+
+// APIKeyPrefix starts every API key, telling them apart from access tokens
+const APIKeyPrefix = "uak_"
+
+// Scopes API keys may be granted, routes declare the one they need in their Rule
+const (
+	ScopeFoodsRead  = "foods:read"
+	ScopeFoodsWrite = "foods:write"
+)
+
+var validScopes = map[string]bool{ScopeFoodsRead: true, ScopeFoodsWrite: true}
+
+// CreateAPIKeyModel model struct, a nil ExpiresAt never expires
+type CreateAPIKeyModel struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// CreatedAPIKeyModel response struct, Key is only ever shown here
+type CreatedAPIKeyModel struct {
+	APIKey
+	Key string
+}
+
+// handleCreateAPIKey mints a key for the authenticated user
+func handleCreateAPIKey(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.APIKeys == nil {
+		respondWithError(w, http.StatusNotFound, ErrAPIKeysNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+
+	var create CreateAPIKeyModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&create)
+	}
+
+	missingParams := ErrMissingParam(checkMissingAPIKeyParams(create))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	for _, scope := range create.Scopes {
+		if !validScopes[scope] {
+			respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidScope)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	if create.ExpiresAt != nil && !create.ExpiresAt.After(now) {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidExpiry)
+		return
+	}
+
+	secret, err := signer.NewOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	key := APIKeyPrefix + secret
+	hash := signer.HashToken(key)
+	apiKey := APIKey{
+		ID:        hash[:16],
+		Name:      create.Name,
+		Email:     user.Email,
+		Prefix:    key[:len(APIKeyPrefix)+6],
+		Hash:      hash,
+		Scopes:    create.Scopes,
+		CreatedAt: now,
+		ExpiresAt: create.ExpiresAt,
+	}
+
+	if err := u.APIKeys.saveAPIKey(apiKey); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedAPIKeyModel{APIKey: apiKey, Key: key})
+}
+
+// handleListAPIKeys responds with the authenticated user's keys, without secrets
+func handleListAPIKeys(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.APIKeys == nil {
+		respondWithError(w, http.StatusNotFound, ErrAPIKeysNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+
+	keys, err := u.APIKeys.findAPIKeysByEmail(user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+// handleRevokeAPIKey revokes the key named by the last path segment
+func handleRevokeAPIKey(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.APIKeys == nil {
+		respondWithError(w, http.StatusNotFound, ErrAPIKeysNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+	id := strings.TrimPrefix(req.URL.Path, "/users/me/api-keys/")
+
+	err := u.APIKeys.revokeAPIKey(user.Email, id)
+
+	if err == ErrAPIKeyNotFound {
+		respondWithError(w, http.StatusNotFound, ErrAPIKeyNotFound.Error())
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// usableAPIKey delivers the stored key when it exists, is not revoked and has not expired
+func usableAPIKey(store APIKeyStore, key string, now time.Time) (APIKey, error) {
+	apiKey, err := store.findAPIKey(signer.HashToken(key))
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if apiKey.Revoked || (apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now)) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return apiKey, nil
+}
+
+func hasScope(key APIKey, scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func checkMissingAPIKeyParams(create CreateAPIKeyModel) (missingParams string) {
+	if create.Name == "" {
+		missingParams += "Name, "
+	}
+
+	if len(create.Scopes) == 0 {
+		missingParams += "Scopes, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
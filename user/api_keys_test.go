@@ -0,0 +1,204 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	t.Run("Delivers 404 status code on every route without a key store", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.APIKeys = nil
+		store.foundUser = makeCurrentUser()
+
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPost, "/users/me/api-keys"},
+			{http.MethodGet, "/users/me/api-keys"},
+			{http.MethodDelete, "/users/me/api-keys/any-id"},
+		} {
+			response := makeAuthenticatedRequestWithBody(t, sut, route.method, route.path, `{"name": "any-name", "scopes": ["foods:read"]}`)
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrAPIKeysNotConfigured)
+		}
+	})
+
+	t.Run("Delivers 422 status code and missing params", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/me/api-keys", `{}`)
+
+		want := ErrMissingParam("Name, Scopes")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 422 status code on unknown scope", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/me/api-keys", `{"name": "script", "scopes": ["foods:delete"]}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrInvalidScope)
+	})
+
+	t.Run("Delivers 422 status code on past expiry", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/me/api-keys", `{"name": "script", "scopes": ["foods:read"], "expiresAt": "2000-01-01T00:00:00Z"}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrInvalidExpiry)
+	})
+
+	t.Run("Delivers the key once and stores only its hash", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/me/api-keys", `{"name": "script", "scopes": ["foods:read", "foods:write"]}`)
+
+		var got CreatedAPIKeyModel
+		json.NewDecoder(response.Body).Decode(&got)
+		stored, err := sut.APIKeys.findAPIKey(signer.HashToken(got.Key))
+
+		assertStatusCode(t, response.Code, http.StatusCreated)
+		assertPrefix(t, got.Key, APIKeyPrefix)
+		assertPrefix(t, got.Key, got.Prefix)
+
+		if err != nil || stored.Email != "email@mail.com" || stored.Name != "script" || len(stored.Scopes) != 2 {
+			t.Errorf("got %v and %v, want stored key", stored, err)
+		}
+
+		if strings.Contains(response.Body.String(), stored.Hash) {
+			t.Errorf("got %s, want hash left out", response.Body.String())
+		}
+	})
+}
+
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	t.Run("Lists only the caller's keys", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		sut.APIKeys.saveAPIKey(APIKey{ID: "mine", Email: "email@mail.com"})
+		sut.APIKeys.saveAPIKey(APIKey{ID: "theirs", Email: "other@mail.com"})
+
+		request, _ := http.NewRequest(http.MethodGet, "/users/me/api-keys", nil)
+		request.Header.Set("Authorization", "Bearer any-token")
+		response := httptest.NewRecorder()
+		sut.ServeHTTP(response, request)
+
+		var got []APIKey
+		json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertCalls(t, len(got), 1)
+		assertString(t, got[0].ID, "mine")
+	})
+
+	t.Run("Revokes the caller's key and delivers 404 for others", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		sut.APIKeys.saveAPIKey(APIKey{ID: "mine", Hash: "hash-mine", Email: "email@mail.com"})
+		sut.APIKeys.saveAPIKey(APIKey{ID: "theirs", Hash: "hash-theirs", Email: "other@mail.com"})
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me/api-keys/mine", "")
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+
+		response = makeAuthenticatedRequestWithBody(t, sut, http.MethodDelete, "/users/me/api-keys/theirs", "")
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+
+		mine, _ := sut.APIKeys.findAPIKey("hash-mine")
+		theirs, _ := sut.APIKeys.findAPIKey("hash-theirs")
+		if !mine.Revoked || theirs.Revoked {
+			t.Errorf("got %v and %v, want only mine revoked", mine, theirs)
+		}
+	})
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	makeKeySUT := func(key APIKey) (*Authenticator, *UserStoreSpy, *HandlerSpy) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		sut.APIKeys = &InMemoryAPIKeyStore{}
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleEditor}
+		key.Hash = signer.HashToken(APIKeyPrefix + "secret")
+		key.Email = "email@mail.com"
+		sut.APIKeys.saveAPIKey(key)
+		return sut, store, next
+	}
+	keyHeader := fmt.Sprintf("Bearer %ssecret", APIKeyPrefix)
+	policy := Policy{"GET /any": {Scope: ScopeFoodsRead}}
+
+	t.Run("Calls next with the key's owner for granted scopes", func(t *testing.T) {
+		sut, store, next := makeKeySUT(APIKey{Scopes: []string{ScopeFoodsRead}})
+
+		makeAuthenticatedRequest(t, sut.Authorize(policy, next), keyHeader)
+
+		assertCalls(t, next.calls, 1)
+		assertString(t, store.findEmailParam, "email@mail.com")
+		assertString(t, next.user.Email, "email@mail.com")
+
+		used, _ := sut.APIKeys.findAPIKey(signer.HashToken(APIKeyPrefix + "secret"))
+		if used.LastUsedAt == nil {
+			t.Errorf("got %v, want last use recorded", used)
+		}
+	})
+
+	t.Run("Delivers 403 outside the key's scopes and on undeclared routes", func(t *testing.T) {
+		sut, _, next := makeKeySUT(APIKey{Scopes: []string{ScopeFoodsWrite}})
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), keyHeader)
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrInsufficientScope)
+
+		response = makeAuthenticatedRequest(t, sut.Authorize(Policy{}, next), keyHeader)
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+
+		response = makeAuthenticatedRequest(t, sut.RequireRole(next, RoleEditor), keyHeader)
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Delivers 401 for revoked, expired and unknown keys", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		for _, key := range []APIKey{{Revoked: true, Scopes: []string{ScopeFoodsRead}}, {ExpiresAt: &past, Scopes: []string{ScopeFoodsRead}}} {
+			sut, _, next := makeKeySUT(key)
+
+			response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), keyHeader)
+
+			assertStatusCode(t, response.Code, http.StatusUnauthorized)
+			assertCalls(t, next.calls, 0)
+		}
+
+		sut, _, next := makeKeySUT(APIKey{Scopes: []string{ScopeFoodsRead}})
+		response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), "Bearer "+APIKeyPrefix+"unknown")
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers 401 for keys of accounts pending deletion", func(t *testing.T) {
+		sut, store, next := makeKeySUT(APIKey{Scopes: []string{ScopeFoodsRead}})
+		store.foundUser.deleteAt = time.Now().Add(time.Hour)
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), keyHeader)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Ignores keys when no key store is configured", func(t *testing.T) {
+		sut, verifier, _, next := makeAuthenticatorSUT(t)
+		verifier.defaultError = signer.ErrInvalidToken
+
+		response := makeAuthenticatedRequest(t, sut.Authenticate(next), keyHeader)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertString(t, verifier.verifiedToken, APIKeyPrefix+"secret")
+	})
+}
@@ -0,0 +1,190 @@
+package user
+
+import (
+	"api/signer"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized error const for missing, invalid or expired tokens
+const ErrUnauthorized = "Unauthorized"
+
+// ErrForbidden error const for authenticated users lacking permission
+const ErrForbidden = "Forbidden"
+
+// ErrEmailNotVerified error const
+const ErrEmailNotVerified = "Email not verified"
+
+// ErrInsufficientScope error const for API keys used outside their scopes
+const ErrInsufficientScope = "API key lacks the required scope"
+
+type contextKey int
+
+const (
+	authenticatedUserKey contextKey = iota
+	authenticatedClaimsKey
+	authenticatedAPIKeyKey
+)
+
+// Authenticator validates bearer tokens and loads the user they were issued for.
+// API keys are only accepted when APIKeys is set
+type Authenticator struct {
+	Verifier signer.Verifier
+	Store    Store
+	APIKeys  APIKeyStore
+}
+
+// Authenticate responds 401 unless the request carries a valid bearer token,
+// otherwise calls next with the authenticated user in the request context
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := bearerToken(req)
+		if token == "" {
+			respondUnauthorized(w)
+			return
+		}
+
+		if a.APIKeys != nil && strings.HasPrefix(token, APIKeyPrefix) {
+			a.authenticateAPIKey(w, req, token, next)
+			return
+		}
+
+		claims, verifyErr := a.Verifier.Verify(token)
+		if verifyErr != nil || claims.Purpose != "" {
+			respondUnauthorized(w)
+			return
+		}
+
+		user, findErr := a.Store.findByID(claims.Subject)
+		if findErr == ErrUserNotFound {
+			respondUnauthorized(w)
+			return
+		}
+
+		if findErr != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), authenticatedUserKey, user)
+		ctx = context.WithValue(ctx, authenticatedClaimsKey, claims)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// authenticateAPIKey calls next with the key's owner and the key itself in the request context
+func (a *Authenticator) authenticateAPIKey(w http.ResponseWriter, req *http.Request, token string, next http.Handler) {
+	now := time.Now().UTC()
+	apiKey, keyErr := usableAPIKey(a.APIKeys, token, now)
+	if keyErr == ErrAPIKeyNotFound {
+		respondUnauthorized(w)
+		return
+	}
+
+	if keyErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	user, findErr := a.Store.findByEmail(apiKey.Email)
+	if findErr == ErrUserNotFound || (findErr == nil && !user.deleteAt.IsZero()) {
+		respondUnauthorized(w)
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	// Usage tracking is informative, failing to record it must not fail the request
+	a.APIKeys.touchAPIKey(apiKey.Hash, now)
+
+	ctx := context.WithValue(req.Context(), authenticatedUserKey, user)
+	ctx = context.WithValue(ctx, authenticatedAPIKeyKey, apiKey)
+	next.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// RequireAdmin authenticates the request and responds 403 unless the user is an admin
+func (a *Authenticator) RequireAdmin(next http.Handler) http.Handler {
+	return a.RequireRole(next, RoleAdmin)
+}
+
+// RequireRole authenticates the request and responds 403 unless the user has one of roles.
+// The stored role is checked rather than the token's, so demotions apply immediately.
+// API keys are refused since no scope is declared
+func (a *Authenticator) RequireRole(next http.Handler, roles ...Role) http.Handler {
+	return a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, _ := AuthenticatedUser(req.Context())
+		if _, viaKey := AuthenticatedAPIKey(req.Context()); viaKey {
+			respondWithError(w, http.StatusForbidden, ErrInsufficientScope)
+			return
+		}
+
+		if !hasRole(user, roles) {
+			respondWithError(w, http.StatusForbidden, ErrForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// Authorize authenticates the request and applies the rule policy declares for its
+// method and path. Routes missing from policy only require a login, API keys need
+// the rule's scope and are refused where none is declared
+func (a *Authenticator) Authorize(policy Policy, next http.Handler) http.Handler {
+	return a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rule := policy.ruleFor(req.Method, req.URL.Path)
+		user, _ := AuthenticatedUser(req.Context())
+		if len(rule.Roles) > 0 && !hasRole(user, rule.Roles) {
+			respondWithError(w, http.StatusForbidden, ErrForbidden)
+			return
+		}
+
+		if rule.Verified && !user.Verified {
+			respondWithError(w, http.StatusForbidden, ErrEmailNotVerified)
+			return
+		}
+
+		if apiKey, viaKey := AuthenticatedAPIKey(req.Context()); viaKey && (rule.Scope == "" || !hasScope(apiKey, rule.Scope)) {
+			respondWithError(w, http.StatusForbidden, ErrInsufficientScope)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// AuthenticatedUser delivers the user placed in the context by Authenticate
+func AuthenticatedUser(ctx context.Context) (DatabaseModel, bool) {
+	user, ok := ctx.Value(authenticatedUserKey).(DatabaseModel)
+	return user, ok
+}
+
+// AuthenticatedClaims delivers the verified token claims placed in the context by Authenticate
+func AuthenticatedClaims(ctx context.Context) (signer.Claims, bool) {
+	claims, ok := ctx.Value(authenticatedClaimsKey).(signer.Claims)
+	return claims, ok
+}
+
+// AuthenticatedAPIKey delivers the API key the request was authenticated with, if any
+func AuthenticatedAPIKey(ctx context.Context) (APIKey, bool) {
+	apiKey, ok := ctx.Value(authenticatedAPIKeyKey).(APIKey)
+	return apiKey, ok
+}
+
+func bearerToken(req *http.Request) string {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+func respondUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	respondWithError(w, http.StatusUnauthorized, ErrUnauthorized)
+}
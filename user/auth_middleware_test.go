@@ -0,0 +1,157 @@
+package user
+
+import (
+	"api/signer"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type VerifierSpy struct {
+	verifiedToken string
+	claims        signer.Claims
+	defaultError  error
+}
+
+func (v *VerifierSpy) Verify(token string) (signer.Claims, error) {
+	v.verifiedToken = token
+	return v.claims, v.defaultError
+}
+
+type HandlerSpy struct {
+	calls int
+	user  DatabaseModel
+	found bool
+}
+
+func (h *HandlerSpy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.calls++
+	h.user, h.found = AuthenticatedUser(req.Context())
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Run("Delivers 401 on missing or malformed authorization header", func(t *testing.T) {
+		for _, header := range []string{"", "Bearer", "Basic abc", "Bearer "} {
+			sut, _, _, next := makeAuthenticatorSUT(t)
+
+			response := makeAuthenticatedRequest(t, sut.Authenticate(next), header)
+
+			assertStatusCode(t, response.Code, http.StatusUnauthorized)
+			assertError(t, response.Body.String(), ErrUnauthorized)
+			assertString(t, response.Header().Get("WWW-Authenticate"), "Bearer")
+			assertCalls(t, next.calls, 0)
+		}
+	})
+
+	t.Run("Verifies bearer token", func(t *testing.T) {
+		sut, verifier, _, next := makeAuthenticatorSUT(t)
+
+		makeAuthenticatedRequest(t, sut.Authenticate(next), "bearer any-token")
+
+		assertString(t, verifier.verifiedToken, "any-token")
+	})
+
+	t.Run("Delivers 401 on verifier failure", func(t *testing.T) {
+		sut, verifier, _, next := makeAuthenticatorSUT(t)
+		verifier.defaultError = signer.ErrExpiredToken
+
+		response := makeAuthenticatedRequest(t, sut.Authenticate(next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Delivers 401 on single purpose tokens", func(t *testing.T) {
+		sut, verifier, _, next := makeAuthenticatorSUT(t)
+		verifier.claims = signer.Claims{Subject: "email@mail.com", Purpose: verifyEmailPurpose}
+
+		response := makeAuthenticatedRequest(t, sut.Authenticate(next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Delivers 401 when token user no longer exists", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.findError = ErrUserNotFound
+
+		response := makeAuthenticatedRequest(t, sut.Authenticate(next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Delivers 500 on store failure", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.findError = errors.New("any-error")
+
+		response := makeAuthenticatedRequest(t, sut.Authenticate(next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+		assertError(t, response.Body.String(), ErrInternalServer)
+	})
+
+	t.Run("Calls next with authenticated user in context", func(t *testing.T) {
+		sut, verifier, store, next := makeAuthenticatorSUT(t)
+		verifier.claims = signer.Claims{Subject: "any-id"}
+		store.foundUser = DatabaseModel{ID: "any-id", Name: "any-name", Email: "email@mail.com"}
+
+		makeAuthenticatedRequest(t, sut.Authenticate(next), "Bearer any-token")
+
+		assertCalls(t, next.calls, 1)
+		assertString(t, store.findIDParam, "any-id")
+
+		if !next.found || next.user.Email != "email@mail.com" {
+			t.Errorf("got %v, want authenticated user in context", next.user)
+		}
+	})
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, next := makeAuthenticatorSUT(t)
+
+		response := makeAuthenticatedRequest(t, sut.RequireAdmin(next), "")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Delivers 403 to non admin users", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedRequest(t, sut.RequireAdmin(next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrForbidden)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Calls next for admin users", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "admin@mail.com", Role: RoleAdmin}
+
+		makeAuthenticatedRequest(t, sut.RequireAdmin(next), "Bearer any-token")
+
+		assertCalls(t, next.calls, 1)
+	})
+}
+
+func makeAuthenticatorSUT(t *testing.T) (*Authenticator, *VerifierSpy, *UserStoreSpy, *HandlerSpy) {
+	verifier := &VerifierSpy{}
+	store := &UserStoreSpy{}
+	return &Authenticator{Verifier: verifier, Store: store}, verifier, store, &HandlerSpy{}
+}
+
+func makeAuthenticatedRequest(t *testing.T, handler http.Handler, authorization string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, "/any", nil)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,118 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// exportedUser is the account as written to the export, with the pending deletion if any
+type exportedUser struct {
+	DatabaseModel
+	DeleteAt *time.Time `json:",omitempty"`
+}
+
+// handleExportData responds with a ZIP holding one JSON file per store with
+// everything kept about the authenticated user
+func handleExportData(u *Server, w http.ResponseWriter, req *http.Request) {
+	current, _ := AuthenticatedUser(req.Context())
+
+	archive, err := exportUserData(u, current)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="personal-data.zip"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+func exportUserData(u *Server, user DatabaseModel) ([]byte, error) {
+	account := exportedUser{DatabaseModel: user}
+	if !user.deleteAt.IsZero() {
+		account.DeleteAt = &user.deleteAt
+	}
+
+	files := map[string]interface{}{"user.json": account}
+
+	sessions, err := u.RefreshTokens.findRefreshTokensByEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	files["sessions.json"] = sessions
+
+	if u.PasswordResets != nil {
+		resets, err := u.PasswordResets.findResetTokensByEmail(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		files["password_resets.json"] = resets
+	}
+
+	if u.APIKeys != nil {
+		keys, err := u.APIKeys.findAPIKeysByEmail(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		files["api_keys.json"] = keys
+	}
+
+	if u.TwoFactors != nil {
+		twoFactor, err := u.TwoFactors.getTwoFactor(user.Email)
+		if err != nil && err != ErrTwoFactorNotFound {
+			return nil, err
+		}
+
+		// The secret would let anyone holding the archive generate codes
+		twoFactor.Secret = ""
+		files["two_factor.json"] = twoFactor
+	}
+
+	if u.Throttle != nil {
+		attempts, err := u.Throttle.attempts(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		files["login_attempts.json"] = attempts
+	}
+
+	for name, data := range u.PersonalData {
+		exported, err := data.ExportUserData(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		files[name+".json"] = exported
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	for _, name := range names {
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(files[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
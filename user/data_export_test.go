@@ -0,0 +1,114 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportData(t *testing.T) {
+	makeExportRequest := func(sut Server) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, "/users/me/export", nil)
+		request.Header.Set("Authorization", "Bearer any-token")
+		response := httptest.NewRecorder()
+		sut.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		request, _ := http.NewRequest(http.MethodGet, "/users/me/export", nil)
+		response := httptest.NewRecorder()
+
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers a ZIP with one JSON file per store", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		data := &PersonalDataSpy{exported: []string{"any-food"}}
+		sut.PersonalData = map[string]PersonalData{"foods": data}
+		store.foundUser = makeCurrentUser()
+		store.foundUser.deleteAt = time.Unix(1000, 0).UTC()
+		saveRefreshToken(t, sut, RefreshToken{Hash: "a", Email: "email@mail.com"})
+		saveRefreshToken(t, sut, RefreshToken{Hash: "b", Email: "other@mail.com"})
+
+		response := makeExportRequest(sut)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, response.Header().Get("Content-Type"), "application/zip")
+		assertString(t, data.exportEmail, "email@mail.com")
+
+		files := readZip(t, response.Body.Bytes())
+		for _, name := range []string{"user.json", "sessions.json", "password_resets.json", "login_attempts.json", "foods.json"} {
+			if _, ok := files[name]; !ok {
+				t.Errorf("got files %v, want %q", files, name)
+			}
+		}
+
+		var account map[string]interface{}
+		json.Unmarshal(files["user.json"], &account)
+		assertString(t, account["Email"].(string), "email@mail.com")
+		assertString(t, account["DeleteAt"].(string), "1970-01-01T00:16:40Z")
+
+		if _, ok := account["password"]; ok {
+			t.Errorf("got %v, want password hash left out", account)
+		}
+
+		var sessions []RefreshToken
+		json.Unmarshal(files["sessions.json"], &sessions)
+		assertCalls(t, len(sessions), 1)
+
+		var foods []string
+		json.Unmarshal(files["foods.json"], &foods)
+		assertCalls(t, len(foods), 1)
+	})
+
+	t.Run("Leaves out the stores that are not configured", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.PasswordResets = nil
+		store.foundUser = makeCurrentUser()
+
+		response := makeExportRequest(sut)
+
+		files := readZip(t, response.Body.Bytes())
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if _, ok := files["password_resets.json"]; ok {
+			t.Errorf("got files %v, want no password_resets.json", files)
+		}
+	})
+
+	t.Run("Delivers 500 when a store fails", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.PersonalData = map[string]PersonalData{"foods": &PersonalDataSpy{defaultErr: errors.New("any-error")}}
+		store.foundUser = makeCurrentUser()
+
+		response := makeExportRequest(sut)
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+	})
+}
+
+func readZip(t *testing.T, body []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("got %v, want ZIP body", err)
+	}
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		files[file.Name], _ = ioutil.ReadAll(reader)
+		reader.Close()
+	}
+	return files
+}
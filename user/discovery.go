@@ -0,0 +1,122 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"net/http"
+)
+
+// ErrNoPublicKeys error const for signers whose keys can't be published
+const ErrNoPublicKeys = "Tokens are not signed with a public key"
+
+// DiscoveryPath and JWKSPath are where other services find how to verify our tokens
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	JWKSPath      = "/.well-known/jwks.json"
+)
+
+// keysMaxAge lets verifiers cache the key set, short enough for rotations to propagate
+const keysMaxAge = "max-age=300"
+
+// DiscoveryServer publishes the OpenID Connect discovery document and key set of
+// the tokens minted by the users server, so other services can verify them. Issuer
+// must match the iss the signer sets, the userinfo endpoint is served under it.
+// The same keys sign single purpose tokens, such as the one proving the password
+// step of a two-factor login, so verifiers must only accept access tokens: typed
+// at+jwt with the aud the signer sets. sub is the user ID, which never changes
+type DiscoveryServer struct {
+	Issuer string
+	Keys   signer.KeyPublisher
+}
+
+// DiscoveryModel model struct, the provider metadata relevant to verifying tokens
+type DiscoveryModel struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// UserinfoModel model struct, the OpenID Connect standard claims of the user
+type UserinfoModel struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          Role   `json:"role"`
+}
+
+func (d *DiscoveryServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch req.URL.Path {
+	case DiscoveryPath:
+		d.handleDiscovery(w)
+	case JWKSPath:
+		d.handleJWKS(w)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (d *DiscoveryServer) handleDiscovery(w http.ResponseWriter) {
+	keys, err := d.Keys.JWKS()
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, ErrNoPublicKeys)
+		return
+	}
+
+	algorithms := []string{}
+	for _, key := range keys.Keys {
+		if !containsString(algorithms, string(key.Algorithm)) {
+			algorithms = append(algorithms, string(key.Algorithm))
+		}
+	}
+
+	json.NewEncoder(w).Encode(DiscoveryModel{
+		Issuer:                           d.Issuer,
+		JWKSURI:                          d.Issuer + JWKSPath,
+		UserinfoEndpoint:                 d.Issuer + "/users/userinfo",
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: algorithms,
+		ClaimsSupported:                  []string{"iss", "aud", "sub", "iat", "exp", "auth_time", "jti", "name", "email", "email_verified", "role"},
+	})
+}
+
+func (d *DiscoveryServer) handleJWKS(w http.ResponseWriter) {
+	keys, err := d.Keys.JWKS()
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, ErrNoPublicKeys)
+		return
+	}
+
+	w.Header().Set("Cache-Control", keysMaxAge)
+	json.NewEncoder(w).Encode(keys)
+}
+
+// handleUserinfo delivers the standard claims of the user the access token was issued for
+func handleUserinfo(u *Server, w http.ResponseWriter, req *http.Request) {
+	user, _ := AuthenticatedUser(req.Context())
+
+	json.NewEncoder(w).Encode(UserinfoModel{
+		Subject:       user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Role:          user.Role,
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"api/signer"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscovery(t *testing.T) {
+	t.Run("Publishes where to find the keys and userinfo", func(t *testing.T) {
+		sut, _ := makeDiscoverySUT(t)
+
+		response := makeDiscoveryRequest(sut, DiscoveryPath)
+
+		var got DiscoveryModel
+		json.NewDecoder(response.Body).Decode(&got)
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, got.Issuer, "https://api.example.com")
+		assertString(t, got.JWKSURI, "https://api.example.com/.well-known/jwks.json")
+		assertString(t, got.UserinfoEndpoint, "https://api.example.com/users/userinfo")
+
+		if strings.Join(got.IDTokenSigningAlgValuesSupported, ",") != "RS256" {
+			t.Errorf("got %v, want [RS256]", got.IDTokenSigningAlgValuesSupported)
+		}
+	})
+
+	t.Run("Publishes keys that verify the signer's tokens", func(t *testing.T) {
+		sut, tokens := makeDiscoverySUT(t)
+		token, _ := tokens.Sign(signer.Claims{Subject: "any-id"})
+
+		response := makeDiscoveryRequest(sut, JWKSPath)
+
+		var keys signer.JWKS
+		json.NewDecoder(response.Body).Decode(&keys)
+		var claims signer.Claims
+		if err := keys.Verify(token, &claims); err != nil {
+			t.Fatalf("got %v, want token verified by published keys", err)
+		}
+		assertString(t, claims.Issuer, "https://api.example.com")
+		assertString(t, response.Header().Get("Cache-Control"), keysMaxAge)
+	})
+
+	t.Run("Delivers 404 when tokens are signed with a shared secret", func(t *testing.T) {
+		tokens, _ := signer.NewHS256([]byte("any-secret"), time.Hour)
+		sut := &DiscoveryServer{Issuer: "https://api.example.com", Keys: tokens}
+
+		for _, path := range []string{DiscoveryPath, JWKSPath} {
+			response := makeDiscoveryRequest(sut, path)
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrNoPublicKeys)
+		}
+	})
+}
+
+func TestUserinfo(t *testing.T) {
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		request, _ := http.NewRequest(http.MethodGet, "/users/userinfo", nil)
+		response := httptest.NewRecorder()
+
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers the claims of the authenticated user", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		store.foundUser.Role = RoleEditor
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodGet, "/users/userinfo", "")
+
+		want := `{"sub":"any-id","name":"any-name","email":"email@mail.com","email_verified":true,"role":"editor"}`
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, strings.TrimSpace(response.Body.String()), want)
+	})
+}
+
+func makeDiscoverySUT(t *testing.T) (*DiscoveryServer, *signer.JWT) {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwk, _ := signer.NewJWK("", &key.PublicKey)
+	tokens := &signer.JWT{
+		Algorithm:  signer.RS256,
+		KeyID:      jwk.Thumbprint(),
+		Issuer:     "https://api.example.com",
+		PrivateKey: key,
+		PublicKey:  &key.PublicKey,
+		TTL:        time.Hour,
+	}
+	return &DiscoveryServer{Issuer: tokens.Issuer, Keys: tokens}, tokens
+}
+
+func makeDiscoveryRequest(sut *DiscoveryServer, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
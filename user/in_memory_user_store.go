@@ -1,15 +1,172 @@
 package user
 
-// InMemoryUsersStore storage
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InMemoryUsersStore storage, safe for concurrent use
 type InMemoryUsersStore struct {
+	mu    sync.Mutex
 	Users []DatabaseModel
 }
 
 func (i *InMemoryUsersStore) save(user DatabaseModel) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.indexOf(user.Email) >= 0 {
+		return &ErrUserAlreadyExists{Email: user.Email}
+	}
+
 	i.Users = append(i.Users, user)
 	return nil
 }
 
 func (i *InMemoryUsersStore) getAll() ([]DatabaseModel, error) {
-	return i.Users, nil
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]DatabaseModel{}, i.Users...), nil
+}
+
+func (i *InMemoryUsersStore) queryUsers(query UserQuery) (UserPage, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	matching := []DatabaseModel{}
+	for _, user := range i.Users {
+		if query.matches(user) {
+			matching = append(matching, user)
+		}
+	}
+
+	sort.Slice(matching, func(a, b int) bool {
+		return query.before(query.cursorOf(matching[a]), query.cursorOf(matching[b]))
+	})
+
+	page := UserPage{Users: []DatabaseModel{}, Total: len(matching)}
+	for _, user := range matching {
+		if query.After != nil && !query.before(*query.After, query.cursorOf(user)) {
+			continue
+		}
+		if query.Limit > 0 && len(page.Users) == query.Limit {
+			page.More = true
+			break
+		}
+		page.Users = append(page.Users, user)
+	}
+	return page, nil
+}
+
+func (i *InMemoryUsersStore) findByEmail(email string) (DatabaseModel, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, user := range i.Users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return DatabaseModel{}, ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) findByID(id string) (DatabaseModel, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, user := range i.Users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return DatabaseModel{}, ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) updatePassword(email string, hash string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users[index].password = hash
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) setVerified(email string, verified bool) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users[index].Verified = verified
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) setRole(email string, role Role) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users[index].Role = role
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// updateProfile replaces name, email and verification of the user registered with email
+func (i *InMemoryUsersStore) updateProfile(email string, user DatabaseModel) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !strings.EqualFold(email, user.Email) {
+		if i.indexOf(user.Email) >= 0 {
+			return &ErrUserAlreadyExists{Email: user.Email}
+		}
+	}
+
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users[index].Name = user.Name
+			i.Users[index].Email = user.Email
+			i.Users[index].Verified = user.Verified
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) scheduleDeletion(email string, at time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users[index].deleteAt = at
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (i *InMemoryUsersStore) delete(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			i.Users = append(i.Users[:index], i.Users[index+1:]...)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// indexOf delivers where the user registered with email is, or -1, callers hold the lock
+func (i *InMemoryUsersStore) indexOf(email string) int {
+	for index := range i.Users {
+		if strings.EqualFold(i.Users[index].Email, email) {
+			return index
+		}
+	}
+	return -1
 }
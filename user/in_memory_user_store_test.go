@@ -1,8 +1,10 @@
 package user
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestInMemoryStore(t *testing.T) {
@@ -31,3 +33,241 @@ func TestInMemoryStore(t *testing.T) {
 		}
 	})
 }
+
+func TestInMemoryStoreFindByID(t *testing.T) {
+	t.Run("Delivers user with matching ID even after changing email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{ID: "other-id", Email: "other@mail.com"})
+		store.save(DatabaseModel{ID: "any-id", Name: "any-name", Email: "any@mail.com"})
+		store.updateProfile("any@mail.com", DatabaseModel{Name: "any-name", Email: "new@mail.com"})
+
+		got, err := store.findByID("any-id")
+
+		if err != nil || got.ID != "any-id" || got.Email != "new@mail.com" {
+			t.Errorf("got %v and %v, want any-id with the new email", got, err)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown ID", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		if _, err := store.findByID("any-id"); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreFindByEmail(t *testing.T) {
+	t.Run("Delivers user with matching email", func(t *testing.T) {
+		want := DatabaseModel{Name: "any-name", Email: "any@mail.com", password: "any-password"}
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Name: "other", Email: "other@mail.com"})
+		store.save(want)
+
+		got, err := store.findByEmail("any@mail.com")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		_, err := store.findByEmail("any@mail.com")
+
+		if err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreUniqueEmail(t *testing.T) {
+	t.Run("Delivers ErrUserAlreadyExists on duplicate email regardless of case", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Name: "any-name", Email: "any@mail.com"})
+
+		err := store.save(DatabaseModel{Name: "other-name", Email: "Any@Mail.com"})
+
+		var alreadyExists *ErrUserAlreadyExists
+		if !errors.As(err, &alreadyExists) {
+			t.Fatalf("got %v, want ErrUserAlreadyExists", err)
+		}
+
+		if len(store.Users) != 1 {
+			t.Errorf("got %d users, want 1", len(store.Users))
+		}
+	})
+}
+
+func TestInMemoryStoreUpdatePassword(t *testing.T) {
+	t.Run("Replaces stored hash of matching user", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Name: "any-name", Email: "any@mail.com", password: "old-hash"})
+
+		err := store.updatePassword("any@mail.com", "new-hash")
+
+		got, _ := store.findByEmail("any@mail.com")
+		if err != nil || got.password != "new-hash" {
+			t.Errorf("got %q and %v, want new-hash and nil", got.password, err)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		if err := store.updatePassword("any@mail.com", "new-hash"); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreSetVerified(t *testing.T) {
+	t.Run("Marks matching user as verified", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Name: "any-name", Email: "any@mail.com"})
+
+		err := store.setVerified("any@mail.com", true)
+
+		got, _ := store.findByEmail("any@mail.com")
+		if err != nil || !got.Verified {
+			t.Errorf("got %v and %v, want verified and nil", got.Verified, err)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		if err := store.setVerified("any@mail.com", true); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreUpdateProfile(t *testing.T) {
+	t.Run("Replaces name, email and verification keeping the password", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Name: "any-name", Email: "any@mail.com", Verified: true, password: "hash"})
+
+		err := store.updateProfile("any@mail.com", DatabaseModel{Name: "new-name", Email: "new@mail.com"})
+
+		got, _ := store.findByEmail("new@mail.com")
+		want := DatabaseModel{Name: "new-name", Email: "new@mail.com", password: "hash"}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v and %v, want %v and nil", got, err, want)
+		}
+	})
+
+	t.Run("Delivers ErrUserAlreadyExists when the new email is taken", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Email: "any@mail.com"})
+		store.save(DatabaseModel{Email: "taken@mail.com"})
+
+		err := store.updateProfile("any@mail.com", DatabaseModel{Email: "Taken@mail.com"})
+
+		var alreadyExists *ErrUserAlreadyExists
+		if !errors.As(err, &alreadyExists) {
+			t.Errorf("got %v, want ErrUserAlreadyExists", err)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		if err := store.updateProfile("any@mail.com", DatabaseModel{Email: "any@mail.com"}); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreDeletion(t *testing.T) {
+	t.Run("Schedules and cancels the deletion", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Email: "any@mail.com"})
+		at := time.Unix(1000, 0)
+
+		store.scheduleDeletion("any@mail.com", at)
+		got, _ := store.findByEmail("any@mail.com")
+		if !got.deleteAt.Equal(at) {
+			t.Errorf("got %v, want %v", got.deleteAt, at)
+		}
+
+		store.scheduleDeletion("any@mail.com", time.Time{})
+		got, _ = store.findByEmail("any@mail.com")
+		if !got.deleteAt.IsZero() {
+			t.Errorf("got %v, want deletion cancelled", got.deleteAt)
+		}
+	})
+
+	t.Run("Deletes only the matching user", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+		store.save(DatabaseModel{Email: "any@mail.com"})
+		store.save(DatabaseModel{Email: "other@mail.com"})
+
+		err := store.delete("Any@mail.com")
+
+		want := []DatabaseModel{{Email: "other@mail.com"}}
+		if err != nil || !reflect.DeepEqual(store.Users, want) {
+			t.Errorf("got %v and %v, want %v and nil", store.Users, err, want)
+		}
+	})
+
+	t.Run("Delivers ErrUserNotFound on unknown email", func(t *testing.T) {
+		store := InMemoryUsersStore{}
+
+		if err := store.delete("any@mail.com"); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+
+		if err := store.scheduleDeletion("any@mail.com", time.Now()); err != ErrUserNotFound {
+			t.Errorf("got %v, want %v", err, ErrUserNotFound)
+		}
+	})
+}
+
+func TestInMemoryStoreQueryUsers(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := InMemoryUsersStore{Users: []DatabaseModel{
+		{Name: "bob", Email: "bob@mail.com", Role: RoleEditor, Verified: true, CreatedAt: created},
+		{Name: "Ann", Email: "ann@other.com", Role: RoleMember, CreatedAt: created.Add(time.Hour)},
+		{Name: "ann", Email: "ann@mail.com", Role: RoleMember, Verified: true, CreatedAt: created.Add(2 * time.Hour)},
+	}}
+	emailsOf := func(page UserPage) []string {
+		emails := []string{}
+		for _, user := range page.Users {
+			emails = append(emails, user.Email)
+		}
+		return emails
+	}
+	verified := true
+
+	cases := []struct {
+		name  string
+		query UserQuery
+		want  []string
+		total int
+		more  bool
+	}{
+		{"oldest first", UserQuery{Sort: SortByCreatedAt}, []string{"bob@mail.com", "ann@other.com", "ann@mail.com"}, 3, false},
+		{"newest first", UserQuery{Sort: SortByCreatedAt, Descending: true}, []string{"ann@mail.com", "ann@other.com", "bob@mail.com"}, 3, false},
+		{"names ignoring case, ties by email", UserQuery{Sort: SortByName}, []string{"ann@mail.com", "ann@other.com", "bob@mail.com"}, 3, false},
+		{"by domain", UserQuery{Sort: SortByEmail, Domain: "mail.com"}, []string{"ann@mail.com", "bob@mail.com"}, 2, false},
+		{"by role and verification", UserQuery{Sort: SortByEmail, Role: RoleMember, Verified: &verified}, []string{"ann@mail.com"}, 1, false},
+		{"first page", UserQuery{Sort: SortByEmail, Limit: 2}, []string{"ann@mail.com", "ann@other.com"}, 3, true},
+		{"after a cursor", UserQuery{Sort: SortByEmail, Limit: 2, After: &UserCursor{Key: "ann@other.com", Email: "ann@other.com"}}, []string{"bob@mail.com"}, 3, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := store.queryUsers(c.query)
+
+			if err != nil || !reflect.DeepEqual(emailsOf(got), c.want) || got.Total != c.total || got.More != c.more {
+				t.Errorf("got %v, total %d, more %v and %v, want %v, total %d, more %v", emailsOf(got), got.Total, got.More, err, c.want, c.total, c.more)
+			}
+		})
+	}
+}
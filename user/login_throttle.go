@@ -0,0 +1,351 @@
+package user
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrTooManyAttempts error const
+const ErrTooManyAttempts = "Too many failed login attempts, try again later"
+
+// ErrThrottleNotConfigured error const
+const ErrThrottleNotConfigured = "Login throttling is not configured"
+
+// LoginAttempts failed login counter for an account or IP
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore failed login counter store interface. reserveAttempt passes the
+// counter of key to count and saves what it delivers unless it refuses, atomically
+// so concurrent attempts can't all pass the check before any of them is counted
+type AttemptStore interface {
+	getAttempts(key string) (LoginAttempts, error)
+	reserveAttempt(key string, count func(LoginAttempts) (LoginAttempts, bool)) (bool, error)
+	releaseAttempt(key string) error
+	resetAttempts(key string) error
+}
+
+// InMemoryAttemptStore storage
+type InMemoryAttemptStore struct {
+	mu       sync.Mutex
+	Attempts map[string]LoginAttempts
+}
+
+func (i *InMemoryAttemptStore) getAttempts(key string) (LoginAttempts, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.Attempts[key], nil
+}
+
+func (i *InMemoryAttemptStore) reserveAttempt(key string, count func(LoginAttempts) (LoginAttempts, bool)) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	attempts, ok := count(i.Attempts[key])
+	if !ok {
+		return false, nil
+	}
+
+	if i.Attempts == nil {
+		i.Attempts = map[string]LoginAttempts{}
+	}
+	i.Attempts[key] = attempts
+	return true, nil
+}
+
+func (i *InMemoryAttemptStore) releaseAttempt(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if attempts, ok := i.Attempts[key]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		i.Attempts[key] = attempts
+	}
+	return nil
+}
+
+func (i *InMemoryAttemptStore) resetAttempts(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.Attempts, key)
+	return nil
+}
+
+// LoginThrottle slows down credential stuffing. After FreeAttempts failures every
+// further attempt waits BaseDelay doubled per failure up to MaxDelay, and reaching
+// MaxAccountFailures or MaxIPFailures locks the key for LockoutDuration. Counters
+// are forgotten FailureWindow after the last failure. Zero values use the defaults
+type LoginThrottle struct {
+	Store              AttemptStore
+	FreeAttempts       int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutDuration    time.Duration
+	FailureWindow      time.Duration
+	now                func() time.Time
+}
+
+// UnlockModel model struct
+type UnlockModel struct {
+	Email string
+}
+
+// retryAfter delivers how long the caller must wait before trying to log in again
+func (l *LoginThrottle) retryAfter(email string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	now := l.clock()
+
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		attempts, err := l.Store.getAttempts(key)
+		if err != nil {
+			return 0, err
+		}
+
+		if blocked := l.blockedFor(l.current(attempts, now), now); blocked > wait {
+			wait = blocked
+		}
+	}
+
+	return wait, nil
+}
+
+// reserveAttempt counts the attempt as failed before the password is checked, unless
+// the IP or the account must wait, and delivers the wait then
+func (l *LoginThrottle) reserveAttempt(email string, ip string) (time.Duration, error) {
+	now := l.clock()
+
+	for _, counter := range l.limits(email, ip) {
+		limit := counter.limit
+		var wait time.Duration
+		_, err := l.Store.reserveAttempt(counter.key, func(stored LoginAttempts) (LoginAttempts, bool) {
+			attempts := l.current(stored, now)
+			if wait = l.blockedFor(attempts, now); wait > 0 {
+				return stored, false
+			}
+			return l.failed(attempts, limit, now), true
+		})
+		if err != nil || wait > 0 {
+			return wait, err
+		}
+	}
+
+	return 0, nil
+}
+
+// releaseAttempt uncounts an attempt reserved for a password that turned out right
+func (l *LoginThrottle) releaseAttempt(email string, ip string) error {
+	for _, counter := range l.limits(email, ip) {
+		if err := l.Store.releaseAttempt(counter.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failure against the account and IP even while they must wait
+func (l *LoginThrottle) recordFailure(email string, ip string) error {
+	now := l.clock()
+
+	for _, counter := range l.limits(email, ip) {
+		limit := counter.limit
+		_, err := l.Store.reserveAttempt(counter.key, func(stored LoginAttempts) (LoginAttempts, bool) {
+			return l.failed(l.current(stored, now), limit, now), true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordSuccess clears the account counter only, so one valid account does not
+// clear an IP that is stuffing credentials for many others
+func (l *LoginThrottle) recordSuccess(email string) error {
+	return l.Store.resetAttempts(accountKey(email))
+}
+
+func (l *LoginThrottle) unlock(email string) error {
+	return l.Store.resetAttempts(accountKey(email))
+}
+
+// attempts delivers the failed login counter kept for the account
+func (l *LoginThrottle) attempts(email string) (LoginAttempts, error) {
+	return l.Store.getAttempts(accountKey(email))
+}
+
+// current forgets stored failures FailureWindow after the last one once unlocked
+func (l *LoginThrottle) current(stored LoginAttempts, now time.Time) LoginAttempts {
+	window := durationWithDefault(l.FailureWindow, time.Hour)
+	if now.After(stored.LockedUntil) && now.Sub(stored.LastFailure) > window {
+		return LoginAttempts{}
+	}
+	return stored
+}
+
+// blockedFor delivers how long attempts must wait for their lockout or delay
+func (l *LoginThrottle) blockedFor(attempts LoginAttempts, now time.Time) time.Duration {
+	blockedUntil := attempts.LockedUntil
+	if delayed := attempts.LastFailure.Add(l.delay(attempts.Failures)); delayed.After(blockedUntil) {
+		blockedUntil = delayed
+	}
+
+	if blockedUntil.After(now) {
+		return blockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// failed counts one more failure, locking once limit is reached
+func (l *LoginThrottle) failed(attempts LoginAttempts, limit int, now time.Time) LoginAttempts {
+	attempts.Failures++
+	attempts.LastFailure = now
+	if attempts.Failures >= limit {
+		attempts.LockedUntil = now.Add(durationWithDefault(l.LockoutDuration, 30*time.Minute))
+	}
+	return attempts
+}
+
+// limits delivers the failures locking the IP and the account, IP first so a throttled
+// IP can't count failures against the accounts it targets
+func (l *LoginThrottle) limits(email string, ip string) []keyLimit {
+	return []keyLimit{
+		{key: ipKey(ip), limit: withDefault(l.MaxIPFailures, 50)},
+		{key: accountKey(email), limit: withDefault(l.MaxAccountFailures, 10)},
+	}
+}
+
+type keyLimit struct {
+	key   string
+	limit int
+}
+
+func (l *LoginThrottle) delay(failures int) time.Duration {
+	excess := failures - withDefault(l.FreeAttempts, 3)
+	if excess <= 0 {
+		return 0
+	}
+
+	maxDelay := durationWithDefault(l.MaxDelay, 15*time.Minute)
+	delay := float64(durationWithDefault(l.BaseDelay, time.Second)) * math.Pow(2, float64(excess-1))
+	if delay > float64(maxDelay) {
+		return maxDelay
+	}
+	return time.Duration(delay)
+}
+
+func (l *LoginThrottle) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// handleUnlock lets admins clear the failed login counter of an account
+func handleUnlock(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.Throttle == nil {
+		respondWithError(w, http.StatusNotFound, ErrThrottleNotConfigured)
+		return
+	}
+
+	var unlock UnlockModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&unlock)
+	}
+
+	unlock.Email = normalizeEmail(unlock.Email)
+	if unlock.Email == "" {
+		err := ErrMissingParam("Email")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := u.Throttle.unlock(unlock.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// throttled counts the attempt as failed up front and responds 429, or 500 when the
+// counters can't be updated, delivering true when the caller must not check a
+// password yet. Callers give the attempt back through attemptPassed
+func throttled(u *Server, w http.ResponseWriter, email string, ip string) bool {
+	if u.Throttle == nil {
+		return false
+	}
+
+	wait, err := u.Throttle.reserveAttempt(email, ip)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return true
+	}
+
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return true
+	}
+
+	return false
+}
+
+// attemptPassed uncounts the attempt throttled counted once the password turned out
+// right, responding 500 and delivering false when it can't
+func attemptPassed(u *Server, w http.ResponseWriter, email string, ip string) bool {
+	if u.Throttle == nil {
+		return true
+	}
+
+	if err := u.Throttle.releaseAttempt(email, ip); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return false
+	}
+	return true
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, ErrTooManyAttempts)
+}
+
+// clientIP uses the connection address; forwarded headers are not trusted since
+// callers could rotate them freely to dodge the per IP counter
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func accountKey(email string) string {
+	return "account:" + email
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func withDefault(value int, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+func durationWithDefault(value time.Duration, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,241 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	t.Run("Lets the first failures through without delay", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 3)
+
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", 0)
+	})
+
+	t.Run("Doubles the delay for every further failure up to the maximum", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 4)
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", time.Second)
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 1)
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", 2*time.Second)
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 3)
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", 10*time.Second)
+	})
+
+	t.Run("Locks the account after too many failures", func(t *testing.T) {
+		sut, now := makeThrottle(t)
+		sut.MaxAccountFailures = 5
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 5)
+		*now = now.Add(10 * time.Second)
+
+		assertWait(t, sut, "any@mail.com", "2.2.2.2", time.Hour-10*time.Second)
+		assertWait(t, sut, "other@mail.com", "2.2.2.2", 0)
+	})
+
+	t.Run("Throttles an IP failing across many accounts", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+
+		for _, email := range []string{"a@mail.com", "b@mail.com", "c@mail.com", "d@mail.com"} {
+			recordFailures(t, sut, email, "1.1.1.1", 1)
+		}
+
+		assertWait(t, sut, "e@mail.com", "1.1.1.1", time.Second)
+		assertWait(t, sut, "e@mail.com", "2.2.2.2", 0)
+	})
+
+	t.Run("Forgets failures after the window", func(t *testing.T) {
+		sut, now := makeThrottle(t)
+
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 4)
+		*now = now.Add(2 * time.Hour)
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 1)
+
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", 0)
+	})
+
+	t.Run("Counts concurrent attempts before letting them through", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		admitted := 0
+		for i := 0; i < 40; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if wait, err := sut.reserveAttempt("any@mail.com", "1.1.1.1"); err == nil && wait == 0 {
+					mu.Lock()
+					admitted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		attempts, _ := sut.attempts("any@mail.com")
+		assertCalls(t, admitted, 4)
+		assertCalls(t, attempts.Failures, 4)
+	})
+
+	t.Run("Gives back attempts whose password was right", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 3)
+
+		sut.reserveAttempt("any@mail.com", "1.1.1.1")
+		sut.releaseAttempt("any@mail.com", "1.1.1.1")
+
+		attempts, _ := sut.attempts("any@mail.com")
+		assertCalls(t, attempts.Failures, 3)
+		assertWait(t, sut, "any@mail.com", "1.1.1.1", 0)
+	})
+
+	t.Run("Clears account counter on success and unlock only", func(t *testing.T) {
+		sut, _ := makeThrottle(t)
+		sut.MaxAccountFailures = 4
+		recordFailures(t, sut, "any@mail.com", "1.1.1.1", 4)
+
+		sut.unlock("any@mail.com")
+
+		assertWait(t, sut, "any@mail.com", "2.2.2.2", 0)
+		assertWait(t, sut, "other@mail.com", "1.1.1.1", time.Second)
+	})
+}
+
+func TestLoginThrottling(t *testing.T) {
+	t.Run("Delivers 429 with Retry-After once throttled", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", password: "hashed_password"}
+		encrypter.compareError = ErrUserNotFound
+
+		for i := 0; i < 4; i++ {
+			response := makeRequestForLogin(t, sut, makeValidLoginBody())
+			assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		}
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+		assertError(t, response.Body.String(), ErrTooManyAttempts)
+		assertString(t, response.Header().Get("Retry-After"), "1")
+	})
+
+	t.Run("Counts unknown emails as failures too", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.findError = ErrUserNotFound
+
+		makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		attempts, _ := sut.Throttle.Store.getAttempts(accountKey("email@mail.com"))
+		assertCalls(t, attempts.Failures, 1)
+	})
+
+	t.Run("Clears account failures on successful login", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+		encrypter.compareError = ErrUserNotFound
+		makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		encrypter.compareError = nil
+		makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		attempts, _ := sut.Throttle.Store.getAttempts(accountKey("email@mail.com"))
+		assertCalls(t, attempts.Failures, 0)
+	})
+}
+
+func TestUnlock(t *testing.T) {
+	t.Run("Delivers 403 to non admin users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/unlock", `{"email": "email@mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("Delivers 404 status code without a throttle", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/unlock", `{"email": "email@mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+		assertError(t, response.Body.String(), ErrThrottleNotConfigured)
+	})
+
+	t.Run("Delivers 422 status code on missing email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/unlock", `{}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Clears the account lockout", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.foundUser = makeAdmin()
+		recordFailures(t, sut.Throttle, "locked@mail.com", "1.1.1.1", 10)
+
+		response := makeAuthenticatedPost(t, sut, "/users/unlock", `{"email": "Locked@Mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertWait(t, sut.Throttle, "locked@mail.com", "2.2.2.2", 0)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(""))
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "1.1.1.1")
+
+	assertString(t, clientIP(request), "10.0.0.1")
+}
+
+func makeThrottle(t *testing.T) (*LoginThrottle, *time.Time) {
+	now := time.Unix(1000, 0)
+	throttle := &LoginThrottle{
+		Store:           &InMemoryAttemptStore{},
+		MaxDelay:        10 * time.Second,
+		LockoutDuration: time.Hour,
+		now:             func() time.Time { return now },
+	}
+	return throttle, &now
+}
+
+func recordFailures(t *testing.T, sut *LoginThrottle, email string, ip string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := sut.recordFailure(email, ip); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+	}
+}
+
+func assertWait(t *testing.T, sut *LoginThrottle, email string, ip string, want time.Duration) {
+	t.Helper()
+	got, err := sut.retryAfter(email, ip)
+
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
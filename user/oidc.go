@@ -0,0 +1,418 @@
+package user
+
+import (
+	"api/signer"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOIDCNotConfigured error const
+const ErrOIDCNotConfigured = "OpenID Connect login is not configured"
+
+// ErrOIDCUnavailable error const for providers that can't be reached or discovered
+const ErrOIDCUnavailable = "Identity provider unavailable"
+
+// ErrOIDCFailed error const for refused authorizations and invalid ID tokens
+const ErrOIDCFailed = "OpenID Connect login failed"
+
+// ErrInvalidLoginState error const for unknown, expired or already used states
+const ErrInvalidLoginState = "Invalid or expired login state"
+
+// ErrOIDCEmailNotVerified error const
+const ErrOIDCEmailNotVerified = "Identity provider did not verify the email"
+
+// OIDCLoginTTL is how long users have to sign in at the provider
+const OIDCLoginTTL = 10 * time.Minute
+
+// idTokenLeeway tolerates clock drift between us and the provider
+const idTokenLeeway = time.Minute
+
+// oidcStateCookie binds a login to the browser that started it with the hash of its
+// state, so nobody can finish their own login in someone else's browser
+const oidcStateCookie = "oidc_state"
+
+// OIDCProvider external OpenID Connect provider users may sign in with through the
+// authorization code flow with PKCE. Endpoints and keys are discovered from Issuer
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	HTTPClient   *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      signer.JWKS
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// oidcAudience accepts the aud claim as a single string or a list
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a oidcAudience) contains(audience string) bool {
+	for _, candidate := range a {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcIDClaims ID token claims the login relies on
+type oidcIDClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   bool         `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// handleOIDCLogin redirects to the provider, remembering the state, nonce and PKCE
+// verifier, and the state's hash in a cookie of the browser
+func handleOIDCLogin(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, ErrOIDCNotConfigured)
+		return
+	}
+
+	discovery, err := u.OIDC.discover()
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, ErrOIDCUnavailable)
+		return
+	}
+
+	secrets := make([]string, 3)
+	for index := range secrets {
+		if secrets[index], err = signer.NewOpaqueToken(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	pending := OIDCLoginState{Nonce: nonce, CodeVerifier: verifier, ExpiresAt: time.Now().Add(OIDCLoginTTL)}
+	if err := u.OIDCStates.saveLoginState(signer.HashToken(state), pending); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	authorization, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, ErrOIDCUnavailable)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    signer.HashToken(state),
+		Path:     "/users/oidc/callback",
+		MaxAge:   int(OIDCLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(u.OIDC.RedirectURL, "https://"),
+		// The provider redirects back cross site, Lax still sends the cookie on that navigation
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := authorization.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", u.OIDC.ClientID)
+	query.Set("redirect_uri", u.OIDC.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authorization.RawQuery = query.Encode()
+
+	http.Redirect(w, req, authorization.String(), http.StatusFound)
+}
+
+// handleOIDCCallback exchanges the provider's code for an ID token and logs in the
+// user with its verified email, registering them on first sign in
+func handleOIDCCallback(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, ErrOIDCNotConfigured)
+		return
+	}
+
+	query := req.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, ErrOIDCFailed)
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		err := ErrMissingParam("code, state")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	cookie, cookieErr := req.Cookie(oidcStateCookie)
+	if cookieErr != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(signer.HashToken(state))) != 1 {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidLoginState)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/users/oidc/callback", MaxAge: -1, HttpOnly: true})
+
+	pending, stateErr := u.OIDCStates.takeLoginState(signer.HashToken(state))
+	if stateErr == ErrLoginStateNotFound || (stateErr == nil && time.Now().After(pending.ExpiresAt)) {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidLoginState)
+		return
+	}
+
+	if stateErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	identity, err := u.OIDC.exchange(code, pending)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, ErrOIDCFailed)
+		return
+	}
+
+	email := normalizeEmail(identity.Email)
+	if !identity.EmailVerified || !validEmail(email) {
+		respondWithError(w, http.StatusForbidden, ErrOIDCEmailNotVerified)
+		return
+	}
+
+	dbUser, err := linkOIDCUser(u, email, identity.Name)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	respondWithSessionOrChallenge(u, w, dbUser)
+}
+
+// linkOIDCUser delivers the user registered with email, creating a verified member
+// without password when there is none. An unverified account may have been
+// registered by someone else, so everything they could sign in with is dropped:
+// password, sessions, API keys and two-factor settings
+func linkOIDCUser(u *Server, email string, name string) (DatabaseModel, error) {
+	dbUser, findErr := u.Store.findByEmail(email)
+
+	if findErr == ErrUserNotFound {
+		if name == "" {
+			name = email
+		}
+		id, err := newUserID()
+		if err != nil {
+			return dbUser, err
+		}
+		dbUser = DatabaseModel{ID: id, Name: name, Email: email, Role: RoleMember, Verified: true, CreatedAt: time.Now().UTC()}
+		return dbUser, u.Store.save(dbUser)
+	}
+
+	if findErr != nil || dbUser.Verified {
+		return dbUser, findErr
+	}
+
+	if err := u.Store.updatePassword(email, ""); err != nil {
+		return dbUser, err
+	}
+
+	if err := revokeAllSessions(u, dbUser); err != nil {
+		return dbUser, err
+	}
+
+	if u.APIKeys != nil {
+		if err := u.APIKeys.purgeAPIKeys(email); err != nil {
+			return dbUser, err
+		}
+	}
+
+	if u.TwoFactors != nil {
+		if err := u.TwoFactors.deleteTwoFactor(email); err != nil {
+			return dbUser, err
+		}
+	}
+
+	if err := u.Store.setVerified(email, true); err != nil {
+		return dbUser, err
+	}
+
+	dbUser.password = ""
+	dbUser.Verified = true
+	return dbUser, nil
+}
+
+// codeChallenge derives the S256 PKCE challenge sent ahead of the verifier
+func codeChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// discover fetches the provider's discovery document once
+func (p *OIDCProvider) discover() (oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return *p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return oidcDiscovery{}, err
+	}
+
+	if discovery.Issuer != p.Issuer {
+		return oidcDiscovery{}, fmt.Errorf("discovery document names issuer %q, want %q", discovery.Issuer, p.Issuer)
+	}
+
+	p.discovery = &discovery
+	return discovery, nil
+}
+
+// signingKeys delivers the cached key set, fetching it again when refresh is set
+func (p *OIDCProvider) signingKeys(jwksURI string, refresh bool) (signer.JWKS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys.Keys) > 0 && !refresh {
+		return p.keys, nil
+	}
+
+	var keys signer.JWKS
+	if err := p.getJSON(jwksURI, &keys); err != nil {
+		return signer.JWKS{}, err
+	}
+
+	p.keys = keys
+	return keys, nil
+}
+
+// exchange redeems the authorization code and delivers the validated ID token claims
+func (p *OIDCProvider) exchange(code string, pending OIDCLoginState) (oidcIDClaims, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return oidcIDClaims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", pending.CodeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oidcIDClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var tokens oidcTokenResponse
+	if err := p.doJSON(req, &tokens); err != nil {
+		return oidcIDClaims{}, err
+	}
+
+	return p.verifyIDToken(discovery, tokens.IDToken, pending.Nonce)
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce of an ID token,
+// fetching the key set again once when the provider rotated its keys
+func (p *OIDCProvider) verifyIDToken(discovery oidcDiscovery, token string, nonce string) (oidcIDClaims, error) {
+	keys, err := p.signingKeys(discovery.JWKSURI, false)
+	if err != nil {
+		return oidcIDClaims{}, err
+	}
+
+	var claims oidcIDClaims
+	err = keys.Verify(token, &claims)
+	if err == signer.ErrUnknownKey {
+		if keys, err = p.signingKeys(discovery.JWKSURI, true); err == nil {
+			err = keys.Verify(token, &claims)
+		}
+	}
+	if err != nil {
+		return oidcIDClaims{}, err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		return oidcIDClaims{}, errors.New("ID token issued by another provider")
+	case !claims.Audience.contains(p.ClientID):
+		return oidcIDClaims{}, errors.New("ID token issued to another client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID:
+		return oidcIDClaims{}, errors.New("ID token authorized for another client")
+	case !now.Before(time.Unix(claims.ExpiresAt, 0).Add(idTokenLeeway)):
+		return oidcIDClaims{}, signer.ErrExpiredToken
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return oidcIDClaims{}, errors.New("ID token nonce does not match the login")
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) getJSON(address string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	return p.doJSON(req, v)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, v interface{}) error {
+	client := p.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s responded %d", req.Method, req.URL, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLoginStateNotFound delivered by stores when no pending login matches the state
+var ErrLoginStateNotFound = errors.New("Login state not found")
+
+// OIDCLoginState secrets of a login sent to the identity provider, stored by the
+// hash of the state parameter until the provider redirects back
+type OIDCLoginState struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// OIDCStateStore pending OpenID Connect login store interface
+type OIDCStateStore interface {
+	saveLoginState(hash string, state OIDCLoginState) error
+	takeLoginState(hash string) (OIDCLoginState, error)
+}
+
+// InMemoryOIDCStateStore storage
+type InMemoryOIDCStateStore struct {
+	mu     sync.Mutex
+	States map[string]OIDCLoginState
+}
+
+func (i *InMemoryOIDCStateStore) saveLoginState(hash string, state OIDCLoginState) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.States == nil {
+		i.States = map[string]OIDCLoginState{}
+	}
+
+	// Abandoned logins would otherwise pile up
+	for key, pending := range i.States {
+		if time.Now().After(pending.ExpiresAt) {
+			delete(i.States, key)
+		}
+	}
+
+	i.States[hash] = state
+	return nil
+}
+
+// takeLoginState delivers the pending login and forgets it, so a state is used once
+func (i *InMemoryOIDCStateStore) takeLoginState(hash string) (OIDCLoginState, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	state, ok := i.States[hash]
+	if !ok {
+		return OIDCLoginState{}, ErrLoginStateNotFound
+	}
+	delete(i.States, hash)
+	return state, nil
+}
@@ -0,0 +1,355 @@
+package user
+
+import (
+	"api/signer"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a minimal OpenID Connect provider issuing ID tokens for codes
+// handed out by authorize, as a browser would after the user signs in
+type fakeProvider struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	kid           string
+	codes         map[string]fakeAuthorization
+	claims        map[string]interface{}
+	jwksRequests  int
+	tokenRequests int
+}
+
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider := &fakeProvider{key: key, kid: "key-1", codes: map[string]fakeAuthorization{}, claims: map[string]interface{}{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize?prompt=login",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		provider.jwksRequests++
+		jwk, _ := signer.NewJWK(provider.kid, &provider.key.PublicKey)
+		json.NewEncoder(w).Encode(signer.JWKS{Keys: []signer.JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		provider.tokenRequests++
+		req.ParseForm()
+		id, secret, _ := req.BasicAuth()
+		authorization, ok := provider.codes[req.PostForm.Get("code")]
+		delete(provider.codes, req.PostForm.Get("code"))
+
+		if !ok || id != "client-id" || secret != "client-secret" || req.PostForm.Get("grant_type") != "authorization_code" ||
+			codeChallenge(req.PostForm.Get("code_verifier")) != authorization.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": provider.idToken(t, authorization.nonce)})
+	})
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// authorize plays the user signing in at the redirect location and delivers the callback params
+func (p *fakeProvider) authorize(t *testing.T, location string) (code string, state string) {
+	t.Helper()
+	redirect, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("got %v, want redirect location", err)
+	}
+
+	query := redirect.Query()
+	if query.Get("client_id") != "client-id" || query.Get("code_challenge_method") != "S256" || query.Get("prompt") != "login" {
+		t.Fatalf("got %q, want authorization request for client-id with PKCE", location)
+	}
+
+	code = fmt.Sprintf("code-%d", len(p.codes)+p.tokenRequests)
+	p.codes[code] = fakeAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return code, query.Get("state")
+}
+
+func (p *fakeProvider) idToken(t *testing.T, nonce string) string {
+	claims := map[string]interface{}{
+		"iss":            p.server.URL,
+		"sub":            "provider-subject",
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "Email@mail.com",
+		"email_verified": true,
+		"name":           "any-name",
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.kid}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Unable to sign ID token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Run("Delivers 404 when no provider is configured", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		response := makeOIDCRequest(t, sut, "/users/oidc/login")
+
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+		assertError(t, response.Body.String(), ErrOIDCNotConfigured)
+	})
+
+	t.Run("Delivers 502 when the provider can't be discovered", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		sut.OIDC = &OIDCProvider{Issuer: "http://127.0.0.1:1", ClientID: "client-id"}
+
+		response := makeOIDCRequest(t, sut, "/users/oidc/login")
+
+		assertStatusCode(t, response.Code, http.StatusBadGateway)
+	})
+
+	t.Run("Redirects to the provider with state, nonce and PKCE challenge", func(t *testing.T) {
+		sut, _, _ := makeOIDCSUT(t)
+
+		response := makeOIDCRequest(t, sut, "/users/oidc/login")
+
+		location, _ := url.Parse(response.Header().Get("Location"))
+		query := location.Query()
+
+		assertStatusCode(t, response.Code, http.StatusFound)
+		assertString(t, query.Get("response_type"), "code")
+		assertString(t, query.Get("redirect_uri"), "http://localhost/users/oidc/callback")
+		assertString(t, query.Get("scope"), "openid email profile")
+
+		for _, param := range []string{"state", "nonce", "code_challenge"} {
+			if query.Get(param) == "" {
+				t.Errorf("got %q, want %s param", location, param)
+			}
+		}
+
+		cookies := response.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value != signer.HashToken(query.Get("state")) || !cookies[0].HttpOnly {
+			t.Errorf("got cookies %v, want the state's hash in an HttpOnly cookie", cookies)
+		}
+	})
+}
+
+func TestOIDCCallback(t *testing.T) {
+	t.Run("Registers a verified member on first sign in", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.findError = ErrUserNotFound
+
+		response := signInWithProvider(t, sut, provider)
+
+		want := DatabaseModel{ID: store.saveUserParams.ID, Name: "any-name", Email: "email@mail.com", Role: RoleMember, Verified: true, CreatedAt: store.saveUserParams.CreatedAt}
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertCalls(t, store.calls, 1)
+
+		if store.saveUserParams != want || want.ID == "" || want.CreatedAt.IsZero() {
+			t.Errorf("got %v, want %v", store.saveUserParams, want)
+		}
+		assertRefreshTokenIssued(t, sut, response.Body.String(), "email@mail.com")
+	})
+
+	t.Run("Links a verified account with the same email", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := signInWithProvider(t, sut, provider)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertCalls(t, store.calls, 0)
+		assertString(t, store.updatedEmail, "")
+	})
+
+	t.Run("Drops every credential of an unverified account with the same email", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = DatabaseModel{Name: "squatter", Email: "email@mail.com", Role: RoleMember, password: "their_hash"}
+		saveRefreshToken(t, sut, RefreshToken{Hash: "theirs", Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+		sut.APIKeys.saveAPIKey(APIKey{ID: "their-key", Email: "email@mail.com", Hash: "their_key_hash"})
+		enableTwoFactor(t, sut)
+
+		response := signInWithProvider(t, sut, provider)
+
+		theirs, _ := sut.RefreshTokens.findRefreshToken("theirs")
+		keys, _ := sut.APIKeys.findAPIKeysByEmail("email@mail.com")
+		_, twoFactorErr := sut.TwoFactors.getTwoFactor("email@mail.com")
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertRefreshTokenIssued(t, sut, response.Body.String(), "email@mail.com")
+		assertString(t, store.updatedEmail, "email@mail.com")
+		assertString(t, store.updatedHash, "")
+		assertString(t, store.verifiedEmail, "email@mail.com")
+		assertCalls(t, len(sut.Revoker.(*RevokerSpy).revokedSubjects), 1)
+		assertCalls(t, len(keys), 0)
+
+		if !theirs.Revoked {
+			t.Errorf("got %v, want earlier refresh tokens revoked", theirs)
+		}
+		if twoFactorErr != ErrTwoFactorNotFound {
+			t.Errorf("got %v, want their two-factor settings deleted", twoFactorErr)
+		}
+	})
+
+	t.Run("Asks for the second factor when enabled", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+		enableTwoFactor(t, sut)
+
+		response := signInWithProvider(t, sut, provider)
+
+		var got MFAChallengeModel
+		json.NewDecoder(response.Body).Decode(&got)
+		if !got.MFARequired {
+			t.Errorf("got %v, want MFARequired", got)
+		}
+	})
+
+	t.Run("Accepts each state once", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+		login := makeOIDCRequest(t, sut, "/users/oidc/login")
+		code, state := provider.authorize(t, login.Header().Get("Location"))
+		callback := "/users/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+		makeOIDCRequest(t, sut, callback, login.Result().Cookies()...)
+
+		response := makeOIDCRequest(t, sut, callback, login.Result().Cookies()...)
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertError(t, response.Body.String(), ErrInvalidLoginState)
+	})
+
+	t.Run("Delivers 400 when another browser started the login", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+		attacker := makeOIDCRequest(t, sut, "/users/oidc/login")
+		victim := makeOIDCRequest(t, sut, "/users/oidc/login")
+		code, state := provider.authorize(t, attacker.Header().Get("Location"))
+		callback := "/users/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+
+		withoutCookie := makeOIDCRequest(t, sut, callback)
+		withOtherCookie := makeOIDCRequest(t, sut, callback, victim.Result().Cookies()...)
+
+		for _, response := range []*httptest.ResponseRecorder{withoutCookie, withOtherCookie} {
+			assertStatusCode(t, response.Code, http.StatusBadRequest)
+			assertError(t, response.Body.String(), ErrInvalidLoginState)
+		}
+		assertCalls(t, store.calls, 0)
+	})
+
+	t.Run("Delivers 401 when the provider refuses the authorization", func(t *testing.T) {
+		sut, _, _ := makeOIDCSUT(t)
+
+		response := makeOIDCRequest(t, sut, "/users/oidc/callback?error=access_denied&state=any")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrOIDCFailed)
+	})
+
+	t.Run("Delivers 401 for ID tokens meant for someone else or expired", func(t *testing.T) {
+		overrides := []map[string]interface{}{
+			{"iss": "https://other.example.com"},
+			{"aud": []string{"other-client"}},
+			{"aud": []string{"client-id", "other-client"}, "azp": "other-client"},
+			{"exp": time.Now().Add(-time.Hour).Unix()},
+			{"nonce": "replayed-nonce"},
+		}
+
+		for _, override := range overrides {
+			sut, store, provider := makeOIDCSUT(t)
+			store.foundUser = makeCurrentUser()
+			provider.claims = override
+
+			response := signInWithProvider(t, sut, provider)
+
+			assertStatusCode(t, response.Code, http.StatusUnauthorized)
+			assertCalls(t, len(sut.RefreshTokens.(*InMemoryRefreshTokenStore).Tokens), 0)
+		}
+	})
+
+	t.Run("Delivers 403 when the provider did not verify the email", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+		provider.claims = map[string]interface{}{"email_verified": false}
+
+		response := signInWithProvider(t, sut, provider)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrOIDCEmailNotVerified)
+	})
+
+	t.Run("Fetches the key set again when the provider rotates keys", func(t *testing.T) {
+		sut, store, provider := makeOIDCSUT(t)
+		store.foundUser = makeCurrentUser()
+		signInWithProvider(t, sut, provider)
+		provider.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+		provider.kid = "key-2"
+
+		response := signInWithProvider(t, sut, provider)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertCalls(t, provider.jwksRequests, 2)
+	})
+}
+
+func makeOIDCSUT(t *testing.T) (Server, *UserStoreSpy, *fakeProvider) {
+	t.Helper()
+	sut, _, store, _ := makeSUT(t)
+	provider := newFakeProvider(t)
+	sut.OIDC = &OIDCProvider{
+		Issuer:       provider.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/users/oidc/callback",
+	}
+	return sut, store, provider
+}
+
+func signInWithProvider(t *testing.T, sut Server, provider *fakeProvider) *httptest.ResponseRecorder {
+	t.Helper()
+	login := makeOIDCRequest(t, sut, "/users/oidc/login")
+	code, state := provider.authorize(t, login.Header().Get("Location"))
+	return makeOIDCRequest(t, sut, "/users/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), login.Result().Cookies()...)
+}
+
+func makeOIDCRequest(t *testing.T, sut Server, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
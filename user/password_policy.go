@@ -0,0 +1,131 @@
+package user
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrWeakPassword error const
+const ErrWeakPassword = "Password does not meet policy"
+
+// PasswordValidator delivers the reasons a password is rejected for the given user, if any
+type PasswordValidator interface {
+	Validate(password string, name string, email string) []string
+}
+
+// PasswordPolicy configurable password rules, MaxLength is in bytes since bcrypt
+// silently ignores everything past 72 bytes
+type PasswordPolicy struct {
+	MinLength          int
+	MaxLength          int
+	RequireUpper       bool
+	RequireLower       bool
+	RequireDigit       bool
+	RequireSymbol      bool
+	RejectPersonalInfo bool
+	Breached           map[string]bool
+}
+
+// DefaultPasswordPolicy used when Server.PasswordPolicy is not set
+var DefaultPasswordPolicy = &PasswordPolicy{MinLength: 8, MaxLength: 72, RejectPersonalInfo: true}
+
+// PolicyViolation response struct listing every rule a password broke
+type PolicyViolation struct {
+	Error   string
+	Reasons []string
+}
+
+// Validate delivers one reason per broken rule
+func (p *PasswordPolicy) Validate(password string, name string, email string) (reasons []string) {
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("Password must be at least %d characters", p.MinLength))
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("Password must be at most %d bytes", p.MaxLength))
+	}
+
+	if p.RequireUpper && strings.IndexFunc(password, unicode.IsUpper) < 0 {
+		reasons = append(reasons, "Password must contain an uppercase letter")
+	}
+
+	if p.RequireLower && strings.IndexFunc(password, unicode.IsLower) < 0 {
+		reasons = append(reasons, "Password must contain a lowercase letter")
+	}
+
+	if p.RequireDigit && strings.IndexFunc(password, unicode.IsDigit) < 0 {
+		reasons = append(reasons, "Password must contain a digit")
+	}
+
+	if p.RequireSymbol && strings.IndexFunc(password, isSymbol) < 0 {
+		reasons = append(reasons, "Password must contain a symbol")
+	}
+
+	if p.RejectPersonalInfo {
+		reasons = append(reasons, personalInfoReasons(password, name, email)...)
+	}
+
+	if p.Breached[strings.ToLower(password)] {
+		reasons = append(reasons, "Password is too common or appeared in a data breach")
+	}
+
+	return
+}
+
+// LoadBreachedPasswords reads one password per line, skipping blank lines and # comments
+func LoadBreachedPasswords(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = true
+	}
+
+	return breached, scanner.Err()
+}
+
+func personalInfoReasons(password string, name string, email string) (reasons []string) {
+	lowered := strings.ToLower(password)
+
+	for _, part := range strings.Fields(strings.ToLower(name)) {
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			reasons = append(reasons, "Password must not contain your name")
+			break
+		}
+	}
+
+	local := strings.ToLower(email)
+	if at := strings.Index(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+
+	if len(local) >= 3 && strings.Contains(lowered, local) {
+		reasons = append(reasons, "Password must not contain your email")
+	}
+
+	return
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+func respondWithPolicyViolation(w http.ResponseWriter, reasons []string) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(PolicyViolation{ErrWeakPassword, reasons})
+}
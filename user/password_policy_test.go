@@ -0,0 +1,121 @@
+package user
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type PasswordValidatorSpy struct {
+	password string
+	name     string
+	email    string
+	reasons  []string
+}
+
+func (p *PasswordValidatorSpy) Validate(password string, name string, email string) []string {
+	p.password, p.name, p.email = password, name, email
+	return p.reasons
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	testingTable := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		want     []string
+	}{
+		{"accepts password meeting every rule", PasswordPolicy{MinLength: 8, MaxLength: 72, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}, "Str0ng!pass", nil},
+		{"rejects short password counting characters", PasswordPolicy{MinLength: 8}, "ççççççç", []string{"Password must be at least 8 characters"}},
+		{"rejects password past bcrypt limit counting bytes", PasswordPolicy{MaxLength: 72}, string(make([]byte, 73)), []string{"Password must be at most 72 bytes"}},
+		{"rejects missing character classes", PasswordPolicy{RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}, "    ", []string{
+			"Password must contain an uppercase letter",
+			"Password must contain a lowercase letter",
+			"Password must contain a digit",
+			"Password must contain a symbol",
+		}},
+		{"rejects password containing the name", PasswordPolicy{RejectPersonalInfo: true}, "ilovejohnny", []string{"Password must not contain your name"}},
+		{"rejects password containing the email", PasswordPolicy{RejectPersonalInfo: true}, "Jdoe1990", []string{"Password must not contain your email"}},
+		{"rejects breached password regardless of case", PasswordPolicy{Breached: map[string]bool{"password123": true}}, "PASSWORD123", []string{"Password is too common or appeared in a data breach"}},
+	}
+
+	for _, testCase := range testingTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := testCase.policy.Validate(testCase.password, "Johnny Smith", "jdoe@mail.com")
+
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("got %q, want %q", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	t.Run("Delivers lower cased passwords skipping comments and blank lines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "breached.txt")
+		ioutil.WriteFile(path, []byte("# common passwords\nPassword123\n\n  qwerty  \n"), 0600)
+
+		got, err := LoadBreachedPasswords(path)
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		want := map[string]bool{"password123": true, "qwerty": true}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers error on missing file", func(t *testing.T) {
+		_, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+
+		if err == nil {
+			t.Errorf("got nil, want failure")
+		}
+	})
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	t.Run("Validates password against the registering user", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		policy := &PasswordValidatorSpy{}
+		sut.PasswordPolicy = policy
+
+		makeRequestForRegistration(t, sut, makeValidBody())
+
+		assertString(t, policy.password, "password123")
+		assertString(t, policy.name, "any-name")
+		assertString(t, policy.email, "email@mail.com")
+	})
+
+	t.Run("Delivers 422 status code with every violated rule", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		sut.PasswordPolicy = &PasswordValidatorSpy{reasons: []string{"first reason", "second reason"}}
+
+		response := makeRequestForRegistration(t, sut, makeValidBody())
+
+		var got PolicyViolation
+		json.NewDecoder(response.Body).Decode(&got)
+		want := PolicyViolation{ErrWeakPassword, []string{"first reason", "second reason"}}
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		assertCalls(t, encrypter.calls, 0)
+		assertCalls(t, store.calls, 0)
+	})
+
+	t.Run("Applies the default policy when none is configured", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		body := `{"name":"any-name", "email": "email@mail.com", "password": "short", "passwordConfirm": "short"}`
+
+		response := makeRequestForRegistration(t, sut, body)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+	})
+}
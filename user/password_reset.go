@@ -0,0 +1,266 @@
+package user
+
+import (
+	"api/mailer"
+	"api/signer"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrInvalidResetToken error const for unknown, expired or already used reset tokens
+const ErrInvalidResetToken = "Invalid or expired password reset token"
+
+// ErrPasswordResetNotConfigured error const
+const ErrPasswordResetNotConfigured = "Password reset is not configured"
+
+// PasswordChanged message const answering reset forms submitted from a browser
+const PasswordChanged = "Password changed, you can log in with the new one"
+
+// DefaultPasswordResetTTL used when Server.PasswordResetTTL is not set
+const DefaultPasswordResetTTL = time.Hour
+
+// resetPasswordForm served to browsers opening the emailed link when no
+// Server.PasswordResetURL page is set
+var resetPasswordForm = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your password</title></head>
+<body>
+<form method="post" action="/users/password/reset">
+<input type="hidden" name="token" value="{{.}}">
+<p><label>New password <input type="password" name="password" autocomplete="new-password" required></label></p>
+<p><label>Confirm it <input type="password" name="passwordConfirm" autocomplete="new-password" required></label></p>
+<p><button type="submit">Reset password</button></p>
+</form>
+</body>
+</html>
+`))
+
+// ForgotPasswordModel model struct
+type ForgotPasswordModel struct {
+	Email string
+}
+
+// ResetPasswordModel model struct
+type ResetPasswordModel struct {
+	Token           string
+	Password        string
+	PasswordConfirm string
+}
+
+// handleForgotPassword mails a reset link when the email is registered, always
+// responding 202 so callers cannot tell which emails have accounts. The account is
+// looked up and mailed in the background, so response times do not tell either
+func handleForgotPassword(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.PasswordResets == nil {
+		respondWithError(w, http.StatusNotFound, ErrPasswordResetNotConfigured)
+		return
+	}
+
+	var forgot ForgotPasswordModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&forgot)
+	}
+
+	forgot.Email = normalizeEmail(forgot.Email)
+	if forgot.Email == "" {
+		err := ErrMissingParam("Email")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	u.inBackground(func() {
+		// Failures are not reported, they would reveal the email is registered
+		if dbUser, err := u.Store.findByEmail(forgot.Email); err == nil {
+			sendPasswordResetEmail(u, dbUser)
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail mails a link to Server.PasswordResetURL with a single use
+// token, or to the built-in reset form when no page is set
+func sendPasswordResetEmail(u *Server, user DatabaseModel) error {
+	token, err := signer.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := u.PasswordResetTTL
+	if ttl == 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+
+	err = u.PasswordResets.saveResetToken(PasswordResetToken{
+		Hash:      signer.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	if u.Mailer == nil {
+		return nil
+	}
+
+	page := u.PasswordResetURL
+	if page == "" {
+		page = u.BaseURL + "/users/password/reset"
+	}
+
+	link := fmt.Sprintf("%s?token=%s", page, url.QueryEscape(token))
+	return u.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse the token below to choose a new password, it expires in %s:\n\n%s\n\n%s\n\nIf you did not ask for it you can ignore this email.\n", user.Name, ttl, token, link),
+	})
+}
+
+// handleResetPasswordForm serves the form the emailed link opens in a browser
+func handleResetPasswordForm(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.PasswordResets == nil {
+		respondWithError(w, http.StatusNotFound, ErrPasswordResetNotConfigured)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	resetPasswordForm.Execute(w, req.URL.Query().Get("token"))
+}
+
+// handleResetPassword sets a new password from a reset token, then revokes every
+// session of the user since whoever held them may have known the old password.
+// Every other reset token of the user is dropped too. Accepts JSON as well as the
+// fields posted by the reset form
+func handleResetPassword(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.PasswordResets == nil {
+		respondWithError(w, http.StatusNotFound, ErrPasswordResetNotConfigured)
+		return
+	}
+
+	var reset ResetPasswordModel
+	submitted := submittedForm(req)
+	if submitted {
+		reset = ResetPasswordModel{Token: req.PostFormValue("token"), Password: req.PostFormValue("password"), PasswordConfirm: req.PostFormValue("passwordConfirm")}
+	} else if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&reset)
+	}
+
+	missingParams := ErrMissingParam(checkMissingResetParams(reset))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	hash := signer.HashToken(reset.Token)
+	stored, findErr := u.PasswordResets.findResetToken(hash)
+
+	if findErr == ErrResetTokenNotFound || (findErr == nil && (stored.Used || !time.Now().Before(stored.ExpiresAt))) {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidResetToken)
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if reset.Password != reset.PasswordConfirm {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrPasswordsDontMatch)
+		return
+	}
+
+	dbUser, userErr := u.Store.findByEmail(stored.Email)
+
+	if userErr == ErrUserNotFound {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidResetToken)
+		return
+	}
+
+	if userErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if reasons := u.passwordPolicy().Validate(reset.Password, dbUser.Name, dbUser.Email); len(reasons) > 0 {
+		respondWithPolicyViolation(w, reasons)
+		return
+	}
+
+	hashed, hashErr := u.Encrypter.Encrypt(reset.Password)
+
+	if hashErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	consumed, consumeErr := u.PasswordResets.consumeResetToken(hash)
+
+	if consumeErr == ErrResetTokenNotFound || (consumeErr == nil && consumed.Used) {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidResetToken)
+		return
+	}
+
+	if consumeErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.Store.updatePassword(dbUser.Email, hashed); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.PasswordResets.purgeResetTokens(dbUser.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := revokeAllSessions(u, dbUser); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if u.Throttle != nil {
+		u.Throttle.unlock(dbUser.Email)
+	}
+
+	if submitted {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, PasswordChanged)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// submittedForm delivers whether the request body was posted by an HTML form
+func submittedForm(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+func checkMissingResetParams(reset ResetPasswordModel) (missingParams string) {
+	if reset.Token == "" {
+		missingParams += "Token, "
+	}
+
+	if reset.Password == "" {
+		missingParams += "Password, "
+	}
+
+	if reset.PasswordConfirm == "" {
+		missingParams += "PasswordConfirm, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
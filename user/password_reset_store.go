@@ -0,0 +1,91 @@
+package user
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrResetTokenNotFound delivered by stores when no reset token matches the hash
+var ErrResetTokenNotFound = errors.New("Password reset token not found")
+
+// PasswordResetToken is stored by hash so a leaked store cannot reset passwords
+type PasswordResetToken struct {
+	Hash      string
+	Email     string
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// PasswordResetStore password reset token store interface
+type PasswordResetStore interface {
+	saveResetToken(token PasswordResetToken) error
+	findResetToken(hash string) (PasswordResetToken, error)
+	consumeResetToken(hash string) (PasswordResetToken, error)
+	findResetTokensByEmail(email string) ([]PasswordResetToken, error)
+	purgeResetTokens(email string) error
+}
+
+// InMemoryPasswordResetStore storage, safe for concurrent use
+type InMemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	Tokens []PasswordResetToken
+}
+
+func (i *InMemoryPasswordResetStore) saveResetToken(token PasswordResetToken) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Tokens = append(i.Tokens, token)
+	return nil
+}
+
+func (i *InMemoryPasswordResetStore) findResetToken(hash string) (PasswordResetToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, token := range i.Tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return PasswordResetToken{}, ErrResetTokenNotFound
+}
+
+// consumeResetToken marks the token used and delivers it as it was, in one step so
+// concurrent resets can't both find it unused
+func (i *InMemoryPasswordResetStore) consumeResetToken(hash string) (PasswordResetToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Tokens {
+		if i.Tokens[index].Hash == hash {
+			token := i.Tokens[index]
+			i.Tokens[index].Used = true
+			return token, nil
+		}
+	}
+	return PasswordResetToken{}, ErrResetTokenNotFound
+}
+
+func (i *InMemoryPasswordResetStore) findResetTokensByEmail(email string) ([]PasswordResetToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	tokens := []PasswordResetToken{}
+	for _, token := range i.Tokens {
+		if token.Email == email {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (i *InMemoryPasswordResetStore) purgeResetTokens(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	kept := i.Tokens[:0]
+	for _, token := range i.Tokens {
+		if token.Email != email {
+			kept = append(kept, token)
+		}
+	}
+	i.Tokens = kept
+	return nil
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInMemoryPasswordResetStore(t *testing.T) {
+	t.Run("Delivers saved token by hash", func(t *testing.T) {
+		want := PasswordResetToken{Hash: "hash", Email: "any@mail.com", ExpiresAt: time.Unix(1000, 0)}
+		store := InMemoryPasswordResetStore{}
+		store.saveResetToken(want)
+
+		got, err := store.findResetToken("hash")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers ErrResetTokenNotFound on unknown hash", func(t *testing.T) {
+		store := InMemoryPasswordResetStore{}
+
+		if _, err := store.findResetToken("hash"); err != ErrResetTokenNotFound {
+			t.Errorf("got %v, want %v", err, ErrResetTokenNotFound)
+		}
+
+		if _, err := store.consumeResetToken("hash"); err != ErrResetTokenNotFound {
+			t.Errorf("got %v, want %v", err, ErrResetTokenNotFound)
+		}
+	})
+
+	t.Run("Marks token as used delivering it as it was", func(t *testing.T) {
+		store := InMemoryPasswordResetStore{}
+		store.saveResetToken(PasswordResetToken{Hash: "hash"})
+
+		first, _ := store.consumeResetToken("hash")
+		second, _ := store.consumeResetToken("hash")
+
+		got, _ := store.findResetToken("hash")
+		if first.Used || !second.Used || !got.Used {
+			t.Errorf("got %v then %v, want unused then used", first, second)
+		}
+	})
+
+	t.Run("Lets a single concurrent consumer find the token unused", func(t *testing.T) {
+		store := InMemoryPasswordResetStore{}
+		store.saveResetToken(PasswordResetToken{Hash: "hash"})
+
+		unused := make(chan bool, 10)
+		var wg sync.WaitGroup
+		for n := 0; n < 10; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, _ := store.consumeResetToken("hash")
+				unused <- !token.Used
+			}()
+		}
+		wg.Wait()
+		close(unused)
+
+		winners := 0
+		for won := range unused {
+			if won {
+				winners++
+			}
+		}
+		assertCalls(t, winners, 1)
+	})
+
+	t.Run("Finds and purges only the tokens of the email", func(t *testing.T) {
+		store := InMemoryPasswordResetStore{}
+		store.saveResetToken(PasswordResetToken{Hash: "a", Email: "any@mail.com"})
+		store.saveResetToken(PasswordResetToken{Hash: "b", Email: "other@mail.com"})
+
+		found, _ := store.findResetTokensByEmail("any@mail.com")
+		if len(found) != 1 || found[0].Hash != "a" {
+			t.Errorf("got %v, want token a", found)
+		}
+
+		store.purgeResetTokens("any@mail.com")
+
+		want := []PasswordResetToken{{Hash: "b", Email: "other@mail.com"}}
+		if !reflect.DeepEqual(store.Tokens, want) {
+			t.Errorf("got %v, want %v", store.Tokens, want)
+		}
+	})
+}
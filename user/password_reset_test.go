@@ -0,0 +1,318 @@
+package user
+
+import (
+	"api/mailer"
+	"api/signer"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForgotPassword(t *testing.T) {
+	t.Run("Delivers 422 status code on missing email", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/forgot", `{}`)
+
+		want := ErrMissingParam("Email")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 404 status code without a reset token store", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		sut.PasswordResets = nil
+
+		for _, path := range []string{"/users/password/forgot", "/users/password/reset"} {
+			response := makeAuthenticatedPost(t, sut, path, `{"email": "email@mail.com"}`)
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrPasswordResetNotConfigured)
+		}
+	})
+
+	t.Run("Survives a background task panicking", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		sut.background = nil
+		done := make(chan struct{})
+
+		sut.inBackground(func() {
+			defer close(done)
+			panic("any-panic")
+		})
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("got no task run, want it run in the background")
+		}
+	})
+
+	t.Run("Delivers 202 without sending anything for unknown emails", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.findError = ErrUserNotFound
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/forgot", `{"email": "email@mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertCalls(t, len(mail.messages), 0)
+	})
+
+	t.Run("Mails a single use token stored only as a hash", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/forgot", `{"email": "Email@Mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertCalls(t, len(mail.messages), 1)
+		assertString(t, mail.messages[0].To, "email@mail.com")
+
+		token := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(mail.messages[0].Body)
+		if token == nil {
+			t.Fatalf("got %q, want reset link", mail.messages[0].Body)
+		}
+
+		stored, err := sut.PasswordResets.findResetToken(signer.HashToken(token[1]))
+		if err != nil {
+			t.Fatalf("got %v, want stored reset token", err)
+		}
+		assertString(t, stored.Email, "email@mail.com")
+	})
+
+	t.Run("Links to the reset page when set", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		sut.BaseURL = "http://localhost:5000"
+		sut.PasswordResetURL = "https://app.example.com/reset"
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		makeAuthenticatedPost(t, sut, "/users/password/forgot", `{"email": "email@mail.com"}`)
+
+		if !strings.Contains(mail.messages[0].Body, "https://app.example.com/reset?token=") {
+			t.Errorf("got %q, want link to the reset page", mail.messages[0].Body)
+		}
+	})
+
+	t.Run("Responds before looking up the account and mailing", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.background = nil
+		release, sent := make(chan struct{}), make(chan mailer.Message, 1)
+		sut.Mailer = MailerFunc(func(message mailer.Message) error {
+			<-release
+			sent <- message
+			return nil
+		})
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/forgot", `{"email": "email@mail.com"}`)
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		close(release)
+
+		select {
+		case message := <-sent:
+			assertString(t, message.To, "email@mail.com")
+		case <-time.After(time.Second):
+			t.Errorf("got no email, want one sent in the background")
+		}
+	})
+
+	t.Run("Delivers 202 even when the email fails", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Mailer = &MailerSpy{defaultError: errors.New("any-error")}
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/forgot", `{"email": "email@mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Run("Delivers 422 status code and missing params", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", `{}`)
+
+		want := ErrMissingParam("Token, Password, PasswordConfirm")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 400 on unknown, used or expired token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		saveResetToken(t, sut, PasswordResetToken{Hash: signer.HashToken("used"), Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour), Used: true})
+		saveResetToken(t, sut, PasswordResetToken{Hash: signer.HashToken("expired"), Email: "email@mail.com", ExpiresAt: time.Now().Add(-time.Minute)})
+
+		for _, token := range []string{"unknown", "used", "expired"} {
+			response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody(token, "newPassword1", "newPassword1"))
+
+			assertStatusCode(t, response.Code, http.StatusBadRequest)
+			assertError(t, response.Body.String(), ErrInvalidResetToken)
+		}
+	})
+
+	t.Run("Delivers 422 status code on non equal passwords", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		saveValidResetToken(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "otherPassword1"))
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrPasswordsDontMatch)
+	})
+
+	t.Run("Applies the registration password policy", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		policy := &PasswordValidatorSpy{reasons: []string{"any reason"}}
+		sut.PasswordPolicy = policy
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		saveValidResetToken(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertString(t, policy.name, "any-name")
+		assertString(t, store.updatedHash, "")
+	})
+
+	t.Run("Updates password, consumes token and revokes every session", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		encrypter.respondWith("new_hash")
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		saveValidResetToken(t, sut)
+		saveRefreshToken(t, sut, RefreshToken{Hash: "refresh", Family: "family", Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+		sut.APIKeys.saveAPIKey(APIKey{ID: "key", Hash: "hash-key", Email: "email@mail.com"})
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertString(t, encrypter.encryptParam, "newPassword1")
+		assertString(t, store.updatedEmail, "email@mail.com")
+		assertString(t, store.updatedHash, "new_hash")
+		assertCalls(t, len(revoker.revokedSubjects), 1)
+
+		refresh, _ := sut.RefreshTokens.findRefreshToken("refresh")
+		if !refresh.Revoked {
+			t.Errorf("got active refresh token, want revoked")
+		}
+
+		if key, _ := sut.APIKeys.findAPIKey("hash-key"); !key.Revoked {
+			t.Errorf("got active API key, want revoked")
+		}
+
+		reused := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+		assertStatusCode(t, reused.Code, http.StatusBadRequest)
+	})
+
+	t.Run("Invalidates the other reset tokens of the user", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		saveValidResetToken(t, sut)
+		saveResetToken(t, sut, PasswordResetToken{Hash: signer.HashToken("other"), Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+		makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("other", "newPassword2", "newPassword2"))
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertError(t, response.Body.String(), ErrInvalidResetToken)
+	})
+
+	t.Run("Resets from the submitted form", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		encrypter.respondWith("new_hash")
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		saveValidResetToken(t, sut)
+
+		form := url.Values{"token": {"valid"}, "password": {"newPassword1"}, "passwordConfirm": {"newPassword1"}}
+		request, _ := http.NewRequest(http.MethodPost, "/users/password/reset", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertError(t, response.Body.String(), PasswordChanged)
+		assertString(t, store.updatedHash, "new_hash")
+	})
+
+	t.Run("Delivers 400 when a concurrent reset consumed the token first", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		encrypter.respondWith("new_hash")
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		sut.PasswordResets = &racedResetStore{&InMemoryPasswordResetStore{}}
+		saveValidResetToken(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertString(t, store.updatedHash, "")
+	})
+
+	t.Run("Delivers 500 on store failure", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.updateError = errors.New("any-error")
+		saveValidResetToken(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/password/reset", resetBody("valid", "newPassword1", "newPassword1"))
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+	})
+}
+
+// racedResetStore lets another reset consume each token right before the caller does
+type racedResetStore struct {
+	*InMemoryPasswordResetStore
+}
+
+func (r *racedResetStore) consumeResetToken(hash string) (PasswordResetToken, error) {
+	r.InMemoryPasswordResetStore.consumeResetToken(hash)
+	return r.InMemoryPasswordResetStore.consumeResetToken(hash)
+}
+
+func saveResetToken(t *testing.T, sut Server, token PasswordResetToken) {
+	t.Helper()
+	sut.PasswordResets.saveResetToken(token)
+}
+
+func saveValidResetToken(t *testing.T, sut Server) {
+	t.Helper()
+	saveResetToken(t, sut, PasswordResetToken{Hash: signer.HashToken("valid"), Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+}
+
+func resetBody(token string, password string, passwordConfirm string) string {
+	return fmt.Sprintf(`{"token": %q, "password": %q, "passwordConfirm": %q}`, token, password, passwordConfirm)
+}
+
+func TestResetPasswordForm(t *testing.T) {
+	t.Run("Serves the form the emailed link opens with its token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		request, _ := http.NewRequest(http.MethodGet, "/users/password/reset?token=any%22token", nil)
+		response := httptest.NewRecorder()
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, response.Header().Get("Content-Type"), "text/html; charset=utf-8")
+		if body := response.Body.String(); !strings.Contains(body, `value="any&#34;token"`) || !strings.Contains(body, `action="/users/password/reset"`) {
+			t.Errorf("got %q, want a form posting the escaped token", body)
+		}
+	})
+}
+
+type MailerFunc func(message mailer.Message) error
+
+func (m MailerFunc) Send(message mailer.Message) error {
+	return m(message)
+}
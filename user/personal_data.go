@@ -0,0 +1,95 @@
+package user
+
+// PersonalData is implemented by stores outside this package keeping data that
+// belongs to a user, so the data follows the account on export, email change and deletion
+type PersonalData interface {
+	ExportUserData(email string) (interface{}, error)
+	TransferUserData(from string, to string) error
+	PurgeUserData(email string) error
+}
+
+// moveUserData hands the user's data over to a new email, dropping the tokens
+// issued for the old one since they are revoked anyway
+func moveUserData(u *Server, from string, to string) error {
+	for _, data := range u.PersonalData {
+		if err := data.TransferUserData(from, to); err != nil {
+			return err
+		}
+	}
+
+	if err := u.RefreshTokens.purgeRefreshTokens(from); err != nil {
+		return err
+	}
+
+	if u.PasswordResets != nil {
+		if err := u.PasswordResets.purgeResetTokens(from); err != nil {
+			return err
+		}
+	}
+
+	// Keys are credentials like sessions, they stop working with the old email
+	if u.APIKeys != nil {
+		if err := u.APIKeys.purgeAPIKeys(from); err != nil {
+			return err
+		}
+	}
+
+	if u.TwoFactors != nil {
+		twoFactor, err := u.TwoFactors.getTwoFactor(from)
+		if err == nil {
+			err = u.TwoFactors.saveTwoFactor(to, twoFactor)
+		}
+		if err != nil && err != ErrTwoFactorNotFound {
+			return err
+		}
+
+		if err := u.TwoFactors.deleteTwoFactor(from); err != nil {
+			return err
+		}
+	}
+
+	if u.Throttle != nil {
+		return u.Throttle.unlock(from)
+	}
+	return nil
+}
+
+// purgeUserData removes everything kept about the user, the account itself last
+// so a failed purge is retried on the next run
+func purgeUserData(u *Server, email string) error {
+	for _, data := range u.PersonalData {
+		if err := data.PurgeUserData(email); err != nil {
+			return err
+		}
+	}
+
+	if err := u.RefreshTokens.purgeRefreshTokens(email); err != nil {
+		return err
+	}
+
+	if u.PasswordResets != nil {
+		if err := u.PasswordResets.purgeResetTokens(email); err != nil {
+			return err
+		}
+	}
+
+	if u.APIKeys != nil {
+		if err := u.APIKeys.purgeAPIKeys(email); err != nil {
+			return err
+		}
+	}
+
+	if u.TwoFactors != nil {
+		if err := u.TwoFactors.deleteTwoFactor(email); err != nil {
+			return err
+		}
+	}
+
+	if u.Throttle != nil {
+		if err := u.Throttle.unlock(email); err != nil {
+			return err
+		}
+	}
+
+	return u.Store.delete(email)
+}
@@ -0,0 +1,175 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrWrongPassword error const
+const ErrWrongPassword = "Current password is incorrect"
+
+// ProfileModel model struct, empty fields are left unchanged. Password confirms an
+// email change, which would otherwise let a stolen token take the account over
+// through a password reset
+type ProfileModel struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+// ChangePasswordModel model struct
+type ChangePasswordModel struct {
+	CurrentPassword string
+	Password        string
+	PasswordConfirm string
+}
+
+// handleUpdateProfile updates the authenticated user's name and email. Changing
+// the email asks to reauthenticate, marks it unverified, mails a new link and
+// revokes the sessions issued for the old email, so the user logs in again with the new one
+func handleUpdateProfile(u *Server, w http.ResponseWriter, req *http.Request) {
+	current, _ := AuthenticatedUser(req.Context())
+
+	var profile ProfileModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&profile)
+	}
+
+	profile.Email = normalizeEmail(profile.Email)
+	if profile.Name == "" && profile.Email == "" {
+		err := ErrMissingParam("Name, Email")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if profile.Email != "" && !validEmail(profile.Email) {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidEmail)
+		return
+	}
+
+	updated := current
+	if profile.Name != "" {
+		updated.Name = profile.Name
+	}
+
+	emailChanged := profile.Email != "" && profile.Email != current.Email
+	if emailChanged && !reauthenticated(u, w, req, current, profile.Password) {
+		return
+	}
+
+	if emailChanged {
+		updated.Email = profile.Email
+		updated.Verified = false
+	}
+
+	storeErr := u.Store.updateProfile(current.Email, updated)
+
+	var alreadyExists *ErrUserAlreadyExists
+	if errors.As(storeErr, &alreadyExists) {
+		respondWithError(w, http.StatusConflict, ErrEmailTaken)
+		return
+	}
+
+	if storeErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if emailChanged {
+		if err := revokeAllSessions(u, current); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+
+		if err := moveUserData(u, current.Email, updated.Email); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+
+		// The email is already changed, a failed link can be sent again through the resend endpoint
+		sendVerificationEmail(u, updated)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// handleChangePassword replaces the authenticated user's password after checking
+// the current one, then revokes every session so the user logs in again
+func handleChangePassword(u *Server, w http.ResponseWriter, req *http.Request) {
+	current, _ := AuthenticatedUser(req.Context())
+
+	var change ChangePasswordModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&change)
+	}
+
+	missingParams := ErrMissingParam(checkMissingChangePasswordParams(change))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	ip := clientIP(req)
+	if throttled(u, w, current.Email, ip) {
+		return
+	}
+
+	if compareErr := u.Encrypter.Compare(current.password, change.CurrentPassword); compareErr != nil {
+		respondWithError(w, http.StatusForbidden, ErrWrongPassword)
+		return
+	}
+
+	if !attemptPassed(u, w, current.Email, ip) {
+		return
+	}
+
+	if change.Password != change.PasswordConfirm {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrPasswordsDontMatch)
+		return
+	}
+
+	if reasons := u.passwordPolicy().Validate(change.Password, current.Name, current.Email); len(reasons) > 0 {
+		respondWithPolicyViolation(w, reasons)
+		return
+	}
+
+	hashed, hashErr := u.Encrypter.Encrypt(change.Password)
+
+	if hashErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.Store.updatePassword(current.Email, hashed); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := revokeAllSessions(u, current); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func checkMissingChangePasswordParams(change ChangePasswordModel) (missingParams string) {
+	if change.CurrentPassword == "" {
+		missingParams += "CurrentPassword, "
+	}
+
+	if change.Password == "" {
+		missingParams += "Password, "
+	}
+
+	if change.PasswordConfirm == "" {
+		missingParams += "PasswordConfirm, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
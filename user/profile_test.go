@@ -0,0 +1,235 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		request, _ := http.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(`{"name": "new-name"}`))
+		response := httptest.NewRecorder()
+
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers 422 status code when nothing is given", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{}`)
+
+		want := ErrMissingParam("Name, Email")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 422 status code on malformed email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "not-an-email"}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrInvalidEmail)
+	})
+
+	t.Run("Updates name keeping email, verification and sessions", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"name": "new-name"}`)
+
+		var got DatabaseModel
+		json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, store.profileEmail, "email@mail.com")
+		assertString(t, store.profileUpdate.Name, "new-name")
+		assertString(t, store.profileUpdate.Email, "email@mail.com")
+		assertString(t, got.Name, "new-name")
+
+		if !store.profileUpdate.Verified {
+			t.Errorf("got unverified, want verification kept")
+		}
+		assertCalls(t, len(mail.messages), 0)
+		assertCalls(t, len(sut.Revoker.(*RevokerSpy).revokedSubjects), 0)
+	})
+
+	t.Run("Changing email requires verifying it again", func(t *testing.T) {
+		sut, _, store, signerSpy := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "New@Mail.com", "password": "password123"}`)
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, store.profileUpdate.Email, "new@mail.com")
+
+		if store.profileUpdate.Verified {
+			t.Errorf("got verified, want new email unverified")
+		}
+
+		assertCalls(t, len(mail.messages), 1)
+		assertString(t, mail.messages[0].To, "new@mail.com")
+		assertString(t, signerSpy.signedClaims.Purpose, verifyEmailPurpose)
+		assertCalls(t, len(revoker.revokedSubjects), 1)
+		assertString(t, revoker.revokedSubjects[0], "any-id")
+	})
+
+	t.Run("Changing email moves the user's data to the new email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		data := &PersonalDataSpy{}
+		sut.PersonalData = map[string]PersonalData{"foods": data}
+		store.foundUser = makeCurrentUser()
+		saveRefreshToken(t, sut, RefreshToken{Hash: "a", Email: "email@mail.com"})
+
+		makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "new@mail.com", "password": "password123"}`)
+
+		sessions, _ := sut.RefreshTokens.findRefreshTokensByEmail("email@mail.com")
+		assertCalls(t, len(sessions), 0)
+		assertCalls(t, len(data.transfers), 1)
+		assertString(t, data.transfers[0][0], "email@mail.com")
+		assertString(t, data.transfers[0][1], "new@mail.com")
+	})
+
+	t.Run("Changing email requires the current password", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		missing := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "new@mail.com"}`)
+		encrypter.compareError = errors.New("mismatch")
+		wrong := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "new@mail.com", "password": "wrong"}`)
+
+		assertStatusCode(t, missing.Code, http.StatusUnprocessableEntity)
+		assertStatusCode(t, wrong.Code, http.StatusForbidden)
+		assertError(t, wrong.Body.String(), ErrWrongPassword)
+		assertString(t, encrypter.compareHash, "current_hash")
+		assertString(t, store.profileUpdate.Email, "")
+	})
+
+	t.Run("Delivers 409 status code when the email is taken", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		store.updateError = &ErrUserAlreadyExists{Email: "taken@mail.com"}
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"email": "taken@mail.com", "password": "password123"}`)
+
+		assertStatusCode(t, response.Code, http.StatusConflict)
+		assertError(t, response.Body.String(), ErrEmailTaken)
+	})
+
+	t.Run("Delivers 500 on store failure", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		store.updateError = errors.New("any-error")
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPatch, "/users/me", `{"name": "new-name"}`)
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("Delivers 422 status code and missing params", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", `{}`)
+
+		want := ErrMissingParam("CurrentPassword, Password, PasswordConfirm")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 403 on wrong current password", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		encrypter.compareError = errors.New("mismatch")
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", changePasswordBody())
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrWrongPassword)
+		assertString(t, encrypter.compareHash, "current_hash")
+		assertString(t, encrypter.comparePassword, "password123")
+		assertString(t, store.updatedHash, "")
+	})
+
+	t.Run("Counts wrong current passwords towards the lockout", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		sut.Throttle, _ = makeThrottle(t)
+		store.foundUser = makeCurrentUser()
+		encrypter.compareError = errors.New("mismatch")
+
+		for i := 0; i < 4; i++ {
+			makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", changePasswordBody())
+		}
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", changePasswordBody())
+
+		assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Delivers 422 status code on non equal passwords", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", `{"currentPassword": "password123", "password": "newPassword1", "passwordConfirm": "other"}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrPasswordsDontMatch)
+	})
+
+	t.Run("Applies the registration password policy", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.PasswordPolicy = &PasswordValidatorSpy{reasons: []string{"any reason"}}
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", changePasswordBody())
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertString(t, store.updatedHash, "")
+	})
+
+	t.Run("Stores new hash and revokes every session", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		encrypter.respondWith("new_hash")
+
+		response := makeAuthenticatedRequestWithBody(t, sut, http.MethodPut, "/users/me/password", changePasswordBody())
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertString(t, encrypter.encryptParam, "newPassword1")
+		assertString(t, store.updatedEmail, "email@mail.com")
+		assertString(t, store.updatedHash, "new_hash")
+		assertCalls(t, len(sut.Revoker.(*RevokerSpy).revokedSubjects), 1)
+	})
+}
+
+func makeCurrentUser() DatabaseModel {
+	return DatabaseModel{ID: "any-id", Name: "any-name", Email: "email@mail.com", Verified: true, password: "current_hash"}
+}
+
+func changePasswordBody() string {
+	return `{"currentPassword": "password123", "password": "newPassword1", "passwordConfirm": "newPassword1"}`
+}
+
+func makeAuthenticatedRequestWithBody(t *testing.T, sut Server, method string, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer any-token")
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"net/http"
+	"time"
+)
+
+// ErrReauthRequired error const for users without password who signed in too long ago
+const ErrReauthRequired = "Sign in again to confirm"
+
+// DefaultReauthWindow used when Server.ReauthWindow is not set
+const DefaultReauthWindow = 5 * time.Minute
+
+// reauthenticated confirms a sensitive change is made by the account owner. Users with
+// a password give it again, users signing in only through OIDC have no password so
+// they must have signed in within the reauthentication window. Otherwise it responds
+// and delivers false
+func reauthenticated(u *Server, w http.ResponseWriter, req *http.Request, user DatabaseModel, password string) bool {
+	if user.password == "" {
+		window := u.ReauthWindow
+		if window == 0 {
+			window = DefaultReauthWindow
+		}
+
+		claims, ok := AuthenticatedClaims(req.Context())
+		if !ok || claims.AuthTime == 0 || time.Since(time.Unix(claims.AuthTime, 0)) > window {
+			respondWithError(w, http.StatusForbidden, ErrReauthRequired)
+			return false
+		}
+		return true
+	}
+
+	if password == "" {
+		err := ErrMissingParam("Password")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return false
+	}
+
+	ip := clientIP(req)
+	if throttled(u, w, user.Email, ip) {
+		return false
+	}
+
+	if compareErr := u.Encrypter.Compare(user.password, password); compareErr != nil {
+		respondWithError(w, http.StatusForbidden, ErrWrongPassword)
+		return false
+	}
+	return attemptPassed(u, w, user.Email, ip)
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRefreshTokenNotFound delivered by stores when no refresh token matches the hash
+var ErrRefreshTokenNotFound = errors.New("Refresh token not found")
+
+// RefreshToken is stored by hash; every rotation of a login shares the same Family
+// and the AuthTime the user signed in at
+type RefreshToken struct {
+	Hash      string
+	Family    string
+	Email     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// RefreshTokenStore refresh token store interface
+type RefreshTokenStore interface {
+	saveRefreshToken(token RefreshToken) error
+	findRefreshToken(hash string) (RefreshToken, error)
+	consumeRefreshToken(hash string) (RefreshToken, error)
+	revokeFamily(family string) error
+	revokeAllFamilies(email string) error
+	findRefreshTokensByEmail(email string) ([]RefreshToken, error)
+	purgeRefreshTokens(email string) error
+}
+
+// InMemoryRefreshTokenStore storage, safe for concurrent use
+type InMemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	Tokens []RefreshToken
+}
+
+func (i *InMemoryRefreshTokenStore) saveRefreshToken(token RefreshToken) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Tokens = append(i.Tokens, token)
+	return nil
+}
+
+func (i *InMemoryRefreshTokenStore) findRefreshToken(hash string) (RefreshToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, token := range i.Tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return RefreshToken{}, ErrRefreshTokenNotFound
+}
+
+// consumeRefreshToken marks the token used and delivers it as it was, in one step so
+// concurrent replays can't both find it unused
+func (i *InMemoryRefreshTokenStore) consumeRefreshToken(hash string) (RefreshToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Tokens {
+		if i.Tokens[index].Hash == hash {
+			token := i.Tokens[index]
+			i.Tokens[index].Used = true
+			return token, nil
+		}
+	}
+	return RefreshToken{}, ErrRefreshTokenNotFound
+}
+
+func (i *InMemoryRefreshTokenStore) revokeFamily(family string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Tokens {
+		if i.Tokens[index].Family == family {
+			i.Tokens[index].Revoked = true
+		}
+	}
+	return nil
+}
+
+func (i *InMemoryRefreshTokenStore) revokeAllFamilies(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index := range i.Tokens {
+		if i.Tokens[index].Email == email {
+			i.Tokens[index].Revoked = true
+		}
+	}
+	return nil
+}
+
+func (i *InMemoryRefreshTokenStore) findRefreshTokensByEmail(email string) ([]RefreshToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	tokens := []RefreshToken{}
+	for _, token := range i.Tokens {
+		if token.Email == email {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (i *InMemoryRefreshTokenStore) purgeRefreshTokens(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	kept := i.Tokens[:0]
+	for _, token := range i.Tokens {
+		if token.Email != email {
+			kept = append(kept, token)
+		}
+	}
+	i.Tokens = kept
+	return nil
+}
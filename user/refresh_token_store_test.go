@@ -0,0 +1,130 @@
+package user
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInMemoryRefreshTokenStore(t *testing.T) {
+	t.Run("Delivers saved token by hash", func(t *testing.T) {
+		want := RefreshToken{Hash: "hash", Family: "family", Email: "any@mail.com", ExpiresAt: time.Unix(1000, 0)}
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(want)
+
+		got, err := store.findRefreshToken("hash")
+
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delivers ErrRefreshTokenNotFound on unknown hash", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+
+		_, err := store.findRefreshToken("hash")
+
+		if err != ErrRefreshTokenNotFound {
+			t.Errorf("got %v, want %v", err, ErrRefreshTokenNotFound)
+		}
+
+		if _, err := store.consumeRefreshToken("hash"); err != ErrRefreshTokenNotFound {
+			t.Errorf("got %v, want %v", err, ErrRefreshTokenNotFound)
+		}
+	})
+
+	t.Run("Marks token as used delivering it as it was", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(RefreshToken{Hash: "hash"})
+
+		first, _ := store.consumeRefreshToken("hash")
+		second, _ := store.consumeRefreshToken("hash")
+
+		got, _ := store.findRefreshToken("hash")
+		if first.Used || !second.Used || !got.Used {
+			t.Errorf("got %v then %v, want unused then used", first, second)
+		}
+	})
+
+	t.Run("Lets a single concurrent consumer find the token unused", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(RefreshToken{Hash: "hash"})
+
+		unused := make(chan bool, 10)
+		var wg sync.WaitGroup
+		for n := 0; n < 10; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, _ := store.consumeRefreshToken("hash")
+				unused <- !token.Used
+			}()
+		}
+		wg.Wait()
+		close(unused)
+
+		winners := 0
+		for won := range unused {
+			if won {
+				winners++
+			}
+		}
+		assertCalls(t, winners, 1)
+	})
+
+	t.Run("Revokes every token in the family only", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(RefreshToken{Hash: "first", Family: "family"})
+		store.saveRefreshToken(RefreshToken{Hash: "second", Family: "family"})
+		store.saveRefreshToken(RefreshToken{Hash: "other", Family: "other-family"})
+
+		store.revokeFamily("family")
+
+		for hash, want := range map[string]bool{"first": true, "second": true, "other": false} {
+			got, _ := store.findRefreshToken(hash)
+			if got.Revoked != want {
+				t.Errorf("got revoked %v for %q, want %v", got.Revoked, hash, want)
+			}
+		}
+	})
+
+	t.Run("Revokes every token issued to the email only", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(RefreshToken{Hash: "first", Family: "first-family", Email: "any@mail.com"})
+		store.saveRefreshToken(RefreshToken{Hash: "second", Family: "second-family", Email: "any@mail.com"})
+		store.saveRefreshToken(RefreshToken{Hash: "other", Family: "other-family", Email: "other@mail.com"})
+
+		store.revokeAllFamilies("any@mail.com")
+
+		for hash, want := range map[string]bool{"first": true, "second": true, "other": false} {
+			got, _ := store.findRefreshToken(hash)
+			if got.Revoked != want {
+				t.Errorf("got revoked %v for %q, want %v", got.Revoked, hash, want)
+			}
+		}
+	})
+
+	t.Run("Finds and purges only the tokens of the email", func(t *testing.T) {
+		store := InMemoryRefreshTokenStore{}
+		store.saveRefreshToken(RefreshToken{Hash: "a", Email: "any@mail.com"})
+		store.saveRefreshToken(RefreshToken{Hash: "b", Email: "other@mail.com"})
+		store.saveRefreshToken(RefreshToken{Hash: "c", Email: "any@mail.com"})
+
+		found, _ := store.findRefreshTokensByEmail("any@mail.com")
+		if len(found) != 2 || found[0].Hash != "a" || found[1].Hash != "c" {
+			t.Errorf("got %v, want tokens a and c", found)
+		}
+
+		store.purgeRefreshTokens("any@mail.com")
+
+		want := []RefreshToken{{Hash: "b", Email: "other@mail.com"}}
+		if !reflect.DeepEqual(store.Tokens, want) {
+			t.Errorf("got %v, want %v", store.Tokens, want)
+		}
+	})
+}
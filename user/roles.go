@@ -0,0 +1,185 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRole error const
+const ErrInvalidRole = "Invalid role"
+
+// ErrOwnRole error const, admins cannot demote themselves and leave no admin behind
+const ErrOwnRole = "Cannot change your own role"
+
+// ErrAdminExists delivered by BootstrapAdmin once any admin is registered
+var ErrAdminExists = errors.New("An admin already exists")
+
+// Role of a user deciding which routes they may call
+type Role string
+
+// Roles from most to least privileged. Editors curate the foods catalog
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleMember Role = "member"
+)
+
+// Rule of a route: the roles allowed on it, any when empty, the scope API keys need
+// and whether the user must have verified their email
+type Rule struct {
+	Roles    []Role
+	Scope    string
+	Verified bool
+}
+
+// Policy declares the rules of routes keyed by method and path, e.g. "POST /foods".
+// A * path segment matches any single segment, e.g. "DELETE /foods/*"
+type Policy map[string]Rule
+
+// ruleFor delivers the rule declared for the exact route, or else for the first
+// matching pattern in key order
+func (p Policy) ruleFor(method string, requestPath string) Rule {
+	if rule, ok := p[method+" "+requestPath]; ok {
+		return rule
+	}
+
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		parts := strings.SplitN(key, " ", 2)
+		if len(parts) != 2 || parts[0] != method || !strings.Contains(parts[1], "*") {
+			continue
+		}
+		if matched, _ := path.Match(parts[1], requestPath); matched {
+			return p[key]
+		}
+	}
+	return Rule{}
+}
+
+// RoleModel model struct
+type RoleModel struct {
+	Email string
+	Role  Role
+}
+
+func validRole(role Role) bool {
+	return role == RoleAdmin || role == RoleEditor || role == RoleMember
+}
+
+func hasRole(user DatabaseModel, roles []Role) bool {
+	for _, role := range roles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSetRole lets admins change the role of another user, taking effect on their next request
+func handleSetRole(u *Server, w http.ResponseWriter, req *http.Request) {
+	var change RoleModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&change)
+	}
+
+	change.Email = normalizeEmail(change.Email)
+	missingParams := ErrMissingParam(checkMissingRoleParams(change))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	if !validRole(change.Role) {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidRole)
+		return
+	}
+
+	current, _ := AuthenticatedUser(req.Context())
+	if strings.EqualFold(current.Email, change.Email) {
+		respondWithError(w, http.StatusForbidden, ErrOwnRole)
+		return
+	}
+
+	err := u.Store.setRole(change.Email, change.Role)
+
+	if err == ErrUserNotFound {
+		respondWithError(w, http.StatusNotFound, ErrUserNotFound.Error())
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BootstrapAdmin creates the first admin, or promotes the user already registered
+// with email, and fails with ErrAdminExists once there is any admin
+func (u *Server) BootstrapAdmin(name string, email string, password string) error {
+	users, err := u.Store.getAll()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.Role == RoleAdmin {
+			return ErrAdminExists
+		}
+	}
+
+	email = normalizeEmail(email)
+	if !validEmail(email) {
+		return errors.New(ErrInvalidEmail)
+	}
+
+	if _, findErr := u.Store.findByEmail(email); findErr == nil {
+		return u.Store.setRole(email, RoleAdmin)
+	} else if findErr != ErrUserNotFound {
+		return findErr
+	}
+
+	if reasons := u.passwordPolicy().Validate(password, name, email); len(reasons) > 0 {
+		return fmt.Errorf("%s: %s", ErrWeakPassword, strings.Join(reasons, ", "))
+	}
+
+	hashed, err := u.Encrypter.Encrypt(password)
+	if err != nil {
+		return err
+	}
+
+	id, err := newUserID()
+	if err != nil {
+		return err
+	}
+
+	// Whoever runs the server vouches for the address
+	return u.Store.save(DatabaseModel{ID: id, Name: name, Email: email, Role: RoleAdmin, Verified: true, CreatedAt: time.Now().UTC(), password: hashed})
+}
+
+func checkMissingRoleParams(change RoleModel) (missingParams string) {
+	if change.Email == "" {
+		missingParams += "Email, "
+	}
+
+	if change.Role == "" {
+		missingParams += "Role, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	t.Run("Delivers 403 to users without any of the roles", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleMember}
+
+		response := makeAuthenticatedRequest(t, sut.RequireRole(next, RoleAdmin, RoleEditor), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrForbidden)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Calls next for users with one of the roles", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleEditor}
+
+		makeAuthenticatedRequest(t, sut.RequireRole(next, RoleAdmin, RoleEditor), "Bearer any-token")
+
+		assertCalls(t, next.calls, 1)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	policy := Policy{"GET /any": {Roles: []Role{RoleEditor}}}
+
+	t.Run("Delivers 401 to anonymous callers on undeclared routes", func(t *testing.T) {
+		sut, _, _, next := makeAuthenticatorSUT(t)
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), "")
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers 403 when the declared roles don't match", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleMember}
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(policy, next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Applies rules declared for path patterns", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleMember}
+		patterns := Policy{"GET /*": {Roles: []Role{RoleEditor}}, "GET /any/*": {}}
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(patterns, next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Calls next for matching roles and undeclared routes", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Role: RoleEditor}
+
+		makeAuthenticatedRequest(t, sut.Authorize(policy, next), "Bearer any-token")
+		makeAuthenticatedRequest(t, sut.Authorize(Policy{}, next), "Bearer any-token")
+
+		assertCalls(t, next.calls, 2)
+	})
+
+	t.Run("Delivers 403 to unverified users where the rule requires it", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedRequest(t, sut.Authorize(Policy{"GET /any": {Verified: true}}, next), "Bearer any-token")
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrEmailNotVerified)
+		assertCalls(t, next.calls, 0)
+	})
+
+	t.Run("Calls next for verified users where the rule requires it", func(t *testing.T) {
+		sut, _, store, next := makeAuthenticatorSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Verified: true}
+
+		makeAuthenticatedRequest(t, sut.Authorize(Policy{"GET /any": {Verified: true}}, next), "Bearer any-token")
+
+		assertCalls(t, next.calls, 1)
+	})
+}
+
+func TestSetRole(t *testing.T) {
+	t.Run("Delivers 403 to non admin users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{"email": "other@mail.com", "role": "editor"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertString(t, store.roleEmail, "")
+	})
+
+	t.Run("Delivers 422 status code and missing params", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{}`)
+
+		want := ErrMissingParam("Email, Role")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 422 status code on unknown role", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{"email": "other@mail.com", "role": "owner"}`)
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrInvalidRole)
+	})
+
+	t.Run("Delivers 403 when admins change their own role", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{"email": "Admin@mail.com", "role": "member"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrOwnRole)
+	})
+
+	t.Run("Delivers 404 on unknown user", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+		store.updateError = ErrUserNotFound
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{"email": "other@mail.com", "role": "editor"}`)
+
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Stores the new role", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/role", `{"email": "Other@mail.com", "role": "editor"}`)
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertString(t, store.roleEmail, "other@mail.com")
+		assertString(t, string(store.role), string(RoleEditor))
+	})
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	makeBootstrapSUT := func(users ...DatabaseModel) (Server, *InMemoryUsersStore) {
+		sut, encrypter, _, _ := makeSUT(t)
+		encrypter.respondWith("hash")
+		store := &InMemoryUsersStore{Users: users}
+		sut.Store = store
+		return sut, store
+	}
+
+	t.Run("Creates a verified admin", func(t *testing.T) {
+		sut, store := makeBootstrapSUT()
+
+		err := sut.BootstrapAdmin("admin", "Admin@mail.com", "longEnoughPassword1")
+
+		got, _ := store.findByEmail("admin@mail.com")
+		want := DatabaseModel{ID: got.ID, Name: "admin", Email: "admin@mail.com", Role: RoleAdmin, Verified: true, CreatedAt: got.CreatedAt, password: "hash"}
+		if err != nil || got != want || got.ID == "" || got.CreatedAt.IsZero() {
+			t.Errorf("got %v and %v, want %v and nil", got, err, want)
+		}
+	})
+
+	t.Run("Promotes the user already registered with the email", func(t *testing.T) {
+		sut, store := makeBootstrapSUT(DatabaseModel{Email: "admin@mail.com", Role: RoleMember})
+
+		err := sut.BootstrapAdmin("admin", "admin@mail.com", "")
+
+		got, _ := store.findByEmail("admin@mail.com")
+		if err != nil || got.Role != RoleAdmin {
+			t.Errorf("got %v and %v, want admin and nil", got.Role, err)
+		}
+	})
+
+	t.Run("Delivers ErrAdminExists once there is an admin", func(t *testing.T) {
+		sut, store := makeBootstrapSUT(DatabaseModel{Email: "first@mail.com", Role: RoleAdmin})
+
+		err := sut.BootstrapAdmin("admin", "admin@mail.com", "longEnoughPassword1")
+
+		if err != ErrAdminExists {
+			t.Errorf("got %v, want %v", err, ErrAdminExists)
+		}
+		assertCalls(t, len(store.Users), 1)
+	})
+
+	t.Run("Applies the password policy", func(t *testing.T) {
+		sut, store := makeBootstrapSUT()
+
+		err := sut.BootstrapAdmin("admin", "admin@mail.com", "short")
+
+		if err == nil || errors.Is(err, ErrAdminExists) {
+			t.Errorf("got %v, want policy error", err)
+		}
+		assertCalls(t, len(store.Users), 0)
+	})
+}
@@ -0,0 +1,226 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidRefreshToken error const for unknown, expired, used or revoked refresh tokens
+const ErrInvalidRefreshToken = "Invalid refresh token"
+
+// DefaultRefreshTokenTTL used when Server.RefreshTokenTTL is not set
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshModel model struct
+type RefreshModel struct {
+	RefreshToken string
+}
+
+// RevokeSessionsModel model struct
+type RevokeSessionsModel struct {
+	Email string
+}
+
+type signedUserResponse struct {
+	User         DatabaseModel
+	Token        string
+	RefreshToken string
+}
+
+// issueSession signs an access token and a refresh token in the given family,
+// starting a new family when it is empty. authTime is when the user signed in
+func issueSession(u *Server, user DatabaseModel, family string, authTime time.Time) (signedUserResponse, error) {
+	claims := claimsFor(user)
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+
+	token, err := u.Signer.Sign(claims)
+	if err != nil {
+		return signedUserResponse{}, err
+	}
+
+	refreshToken, err := signer.NewOpaqueToken()
+	if err != nil {
+		return signedUserResponse{}, err
+	}
+
+	if family == "" {
+		family, err = signer.NewOpaqueToken()
+		if err != nil {
+			return signedUserResponse{}, err
+		}
+	}
+
+	ttl := u.RefreshTokenTTL
+	if ttl == 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+
+	err = u.RefreshTokens.saveRefreshToken(RefreshToken{
+		Hash:      signer.HashToken(refreshToken),
+		Family:    family,
+		Email:     user.Email,
+		AuthTime:  authTime,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return signedUserResponse{}, err
+	}
+
+	return signedUserResponse{user, token, refreshToken}, nil
+}
+
+// handleRefreshToken rotates a refresh token, revoking its whole family when an
+// already used token is presented again since that means it was stolen. The token
+// is consumed in one step with the reuse check, so only one concurrent replay wins
+func handleRefreshToken(u *Server, w http.ResponseWriter, req *http.Request) {
+	var refresh RefreshModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&refresh)
+	}
+
+	if refresh.RefreshToken == "" {
+		err := ErrMissingParam("RefreshToken")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	hash := signer.HashToken(refresh.RefreshToken)
+	stored, findErr := u.RefreshTokens.consumeRefreshToken(hash)
+
+	if findErr == ErrRefreshTokenNotFound {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidRefreshToken)
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if stored.Used {
+		if err := u.RefreshTokens.revokeFamily(stored.Family); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidRefreshToken)
+		return
+	}
+
+	if stored.Revoked || !time.Now().Before(stored.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidRefreshToken)
+		return
+	}
+
+	dbUser, userErr := u.Store.findByEmail(stored.Email)
+
+	if userErr == ErrUserNotFound {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidRefreshToken)
+		return
+	}
+
+	if userErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	session, sessionErr := issueSession(u, dbUser, stored.Family, stored.AuthTime)
+
+	if sessionErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleLogout revokes the access token used for the request and, when given,
+// the family of the caller's refresh token
+func handleLogout(u *Server, w http.ResponseWriter, req *http.Request) {
+	user, _ := AuthenticatedUser(req.Context())
+	claims, _ := AuthenticatedClaims(req.Context())
+
+	var refresh RefreshModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&refresh)
+	}
+
+	if err := u.Revoker.Revoke(claims); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if refresh.RefreshToken != "" {
+		stored, findErr := u.RefreshTokens.findRefreshToken(signer.HashToken(refresh.RefreshToken))
+
+		if findErr != nil && findErr != ErrRefreshTokenNotFound {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+
+		if findErr == nil && stored.Email == user.Email {
+			if err := u.RefreshTokens.revokeFamily(stored.Family); err != nil {
+				respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeSessions lets admins revoke every access and refresh token of a user
+func handleRevokeSessions(u *Server, w http.ResponseWriter, req *http.Request) {
+	var revoke RevokeSessionsModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&revoke)
+	}
+
+	revoke.Email = normalizeEmail(revoke.Email)
+	if revoke.Email == "" {
+		err := ErrMissingParam("Email")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	dbUser, findErr := u.Store.findByEmail(revoke.Email)
+
+	if findErr == ErrUserNotFound {
+		respondWithError(w, http.StatusNotFound, ErrUserNotFound.Error())
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := revokeAllSessions(u, dbUser); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessions rejects every access token issued to the user so far, named by
+// ID, every refresh token of their email and their API keys, which an attacker who
+// held the account could have minted to keep access after it is recovered
+func revokeAllSessions(u *Server, user DatabaseModel) error {
+	if err := u.Revoker.RevokeSubject(user.ID); err != nil {
+		return err
+	}
+
+	if err := u.RefreshTokens.revokeAllFamilies(user.Email); err != nil {
+		return err
+	}
+
+	if u.APIKeys != nil {
+		return u.APIKeys.revokeAllAPIKeys(user.Email)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type RevokerSpy struct {
+	revokedClaims   []signer.Claims
+	revokedSubjects []string
+	defaultError    error
+}
+
+func (r *RevokerSpy) Revoke(claims signer.Claims) error {
+	r.revokedClaims = append(r.revokedClaims, claims)
+	return r.defaultError
+}
+
+func (r *RevokerSpy) RevokeSubject(subject string) error {
+	r.revokedSubjects = append(r.revokedSubjects, subject)
+	return r.defaultError
+}
+
+func TestRefreshToken(t *testing.T) {
+	t.Run("Delivers 422 status code on missing refresh token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		for _, body := range []string{"", `{}`} {
+			response := makeRequestForRefresh(t, sut, body)
+
+			want := ErrMissingParam("RefreshToken")
+			assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+			assertError(t, response.Body.String(), want.Error())
+		}
+	})
+
+	t.Run("Delivers 401 on unknown refresh token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		response := makeRequestForRefresh(t, sut, refreshBody("unknown"))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidRefreshToken)
+	})
+
+	t.Run("Rotates refresh token keeping the family", func(t *testing.T) {
+		sut, _, store, signer := makeSUT(t)
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+		signer.respondWith("signed_token")
+		first := login(t, sut)
+
+		response := makeRequestForRefresh(t, sut, refreshBody(first.RefreshToken))
+		second := decodeSession(t, response.Body.String())
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, second.Token, "signed_token")
+		assertString(t, second.User.Email, "email@mail.com")
+
+		if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+			t.Errorf("got %q, want a new refresh token", second.RefreshToken)
+		}
+
+		firstStored := findStoredRefreshToken(t, sut, first.RefreshToken)
+		secondStored := findStoredRefreshToken(t, sut, second.RefreshToken)
+
+		if !firstStored.Used {
+			t.Errorf("got unused rotated token, want used")
+		}
+		assertString(t, secondStored.Family, firstStored.Family)
+
+		if !secondStored.AuthTime.Equal(firstStored.AuthTime) || signer.signedClaims.AuthTime != firstStored.AuthTime.Unix() {
+			t.Errorf("got auth time %v and claim %d, want the sign in time %v kept", secondStored.AuthTime, signer.signedClaims.AuthTime, firstStored.AuthTime)
+		}
+	})
+
+	t.Run("Revokes the whole family when a used refresh token is replayed", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+		first := login(t, sut)
+		second := decodeSession(t, makeRequestForRefresh(t, sut, refreshBody(first.RefreshToken)).Body.String())
+
+		replay := makeRequestForRefresh(t, sut, refreshBody(first.RefreshToken))
+		afterReplay := makeRequestForRefresh(t, sut, refreshBody(second.RefreshToken))
+
+		assertStatusCode(t, replay.Code, http.StatusUnauthorized)
+		assertStatusCode(t, afterReplay.Code, http.StatusUnauthorized)
+		assertError(t, afterReplay.Body.String(), ErrInvalidRefreshToken)
+	})
+
+	t.Run("Delivers 401 on expired refresh token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("expired"), Email: "email@mail.com", ExpiresAt: time.Now().Add(-time.Minute)})
+
+		response := makeRequestForRefresh(t, sut, refreshBody("expired"))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers 401 when refresh token user no longer exists", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.findError = ErrUserNotFound
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("valid"), Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+		response := makeRequestForRefresh(t, sut, refreshBody("valid"))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delivers 500 on token creation failure", func(t *testing.T) {
+		sut, _, _, signerSpy := makeSUT(t)
+		signerSpy.defaultError = errors.New("any-error")
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("valid"), Email: "email@mail.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+		response := makeRequestForRefresh(t, sut, refreshBody("valid"))
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+		assertError(t, response.Body.String(), ErrInternalServer)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		request, _ := http.NewRequest(http.MethodPost, "/users/logout", nil)
+		response := httptest.NewRecorder()
+
+		sut.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Revokes the access token used for the request", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id", ID: "token-id"}}
+
+		response := makeAuthenticatedPost(t, sut, "/users/logout", "")
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertCalls(t, len(revoker.revokedClaims), 1)
+		assertString(t, revoker.revokedClaims[0].ID, "token-id")
+	})
+
+	t.Run("Revokes the family of the caller's refresh token", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+		session := login(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/logout", refreshBody(session.RefreshToken))
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		if !findStoredRefreshToken(t, sut, session.RefreshToken).Revoked {
+			t.Errorf("got active refresh token, want revoked")
+		}
+	})
+
+	t.Run("Ignores refresh tokens belonging to someone else", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("other"), Family: "family", Email: "other@mail.com"})
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		makeAuthenticatedPost(t, sut, "/users/logout", refreshBody("other"))
+
+		if findStoredRefreshToken(t, sut, "other").Revoked {
+			t.Errorf("got revoked refresh token, want active")
+		}
+	})
+
+	t.Run("Delivers 500 on revocation failure", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+		sut.Revoker = &RevokerSpy{defaultError: errors.New("any-error")}
+
+		response := makeAuthenticatedPost(t, sut, "/users/logout", "")
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+	})
+}
+
+func TestRevokeSessions(t *testing.T) {
+	t.Run("Delivers 403 to non admin users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/sessions/revoke", `{"email": "email@mail.com"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("Delivers 422 status code on missing email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeAuthenticatedPost(t, sut, "/users/sessions/revoke", `{}`)
+
+		want := ErrMissingParam("Email")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Revokes every access and refresh token and API key of the user", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("first"), Family: "first", Email: "admin@mail.com"})
+		saveRefreshToken(t, sut, RefreshToken{Hash: signer.HashToken("second"), Family: "second", Email: "admin@mail.com"})
+		sut.APIKeys.saveAPIKey(APIKey{ID: "key", Hash: "hash-key", Email: "admin@mail.com"})
+
+		response := makeAuthenticatedPost(t, sut, "/users/sessions/revoke", `{"email": "admin@mail.com"}`)
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		assertCalls(t, len(revoker.revokedSubjects), 1)
+		assertString(t, revoker.revokedSubjects[0], "admin-id")
+
+		for _, token := range []string{"first", "second"} {
+			if !findStoredRefreshToken(t, sut, token).Revoked {
+				t.Errorf("got active refresh token %q, want revoked", token)
+			}
+		}
+
+		if key, _ := sut.APIKeys.findAPIKey("hash-key"); !key.Revoked {
+			t.Errorf("got active API key, want revoked")
+		}
+	})
+}
+
+func makeAuthenticatedPost(t *testing.T, sut Server, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer any-token")
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
+
+func login(t *testing.T, sut Server) signedUserResponse {
+	t.Helper()
+	response := makeRequestForLogin(t, sut, makeValidLoginBody())
+	return decodeSession(t, response.Body.String())
+}
+
+func makeRequestForRefresh(t *testing.T, sut Server, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, "/users/token/refresh", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
+
+func refreshBody(token string) string {
+	return fmt.Sprintf(`{"refreshToken": %q}`, token)
+}
+
+func decodeSession(t *testing.T, body string) signedUserResponse {
+	t.Helper()
+	var session signedUserResponse
+	if err := json.NewDecoder(strings.NewReader(body)).Decode(&session); err != nil {
+		t.Fatalf("Unable to decode %q: %v", body, err)
+	}
+	return session
+}
+
+func saveRefreshToken(t *testing.T, sut Server, token RefreshToken) {
+	t.Helper()
+	sut.RefreshTokens.saveRefreshToken(token)
+}
+
+func findStoredRefreshToken(t *testing.T, sut Server, token string) RefreshToken {
+	t.Helper()
+	stored, err := sut.RefreshTokens.findRefreshToken(signer.HashToken(token))
+	if err != nil {
+		t.Fatalf("got %v, want stored refresh token", err)
+	}
+	return stored
+}
+
+func assertRefreshTokenIssued(t *testing.T, sut Server, body string, email string) {
+	t.Helper()
+	session := decodeSession(t, body)
+	assertString(t, findStoredRefreshToken(t, sut, session.RefreshToken).Email, email)
+}
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	t.Run("Delivers the RFC 6238 codes", func(t *testing.T) {
+		vectors := map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"}
+
+		for unix, want := range vectors {
+			got, err := totpCode(secret, totpCounter(time.Unix(unix, 0)))
+
+			if err != nil || got != want {
+				t.Errorf("got %q and %v at %d, want %q", got, err, unix, want)
+			}
+		}
+	})
+
+	t.Run("Accepts one step of clock drift either way", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+
+		for _, drift := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+			code, _ := totpCode(secret, totpCounter(now.Add(drift)))
+
+			counter, ok := matchTOTP(secret, code, now)
+			if !ok || counter != totpCounter(now.Add(drift)) {
+				t.Errorf("got %d and %v for drift %v, want match", counter, ok, drift)
+			}
+		}
+
+		code, _ := totpCode(secret, totpCounter(now)+2)
+		if _, ok := matchTOTP(secret, code, now); ok {
+			t.Errorf("got match two steps ahead, want none")
+		}
+	})
+
+	t.Run("Delivers an otpauth URI for authenticator apps", func(t *testing.T) {
+		uri, err := url.Parse(totpURI("any issuer", "any@mail.com", "SECRET"))
+
+		if err != nil {
+			t.Fatalf("got %v, want valid URI", err)
+		}
+
+		assertString(t, uri.Scheme, "otpauth")
+		assertString(t, uri.Host, "totp")
+		assertString(t, uri.Path, "/any issuer:any@mail.com")
+		assertString(t, uri.Query().Get("secret"), "SECRET")
+		assertString(t, uri.Query().Get("issuer"), "any issuer")
+		assertString(t, uri.Query().Get("digits"), "6")
+	})
+
+	t.Run("Delivers distinct secrets of 160 bits", func(t *testing.T) {
+		first, _ := newTOTPSecret()
+		second, _ := newTOTPSecret()
+
+		if first == second || len(first) != 32 {
+			t.Errorf("got %q and %q, want distinct 32 character secrets", first, second)
+		}
+	})
+}
@@ -0,0 +1,370 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrTwoFactorEnabled error const
+const ErrTwoFactorEnabled = "Two-factor authentication already enabled"
+
+// ErrTwoFactorNotEnrolled error const
+const ErrTwoFactorNotEnrolled = "Two-factor enrollment not started"
+
+// ErrInvalidTwoFactorCode error const
+const ErrInvalidTwoFactorCode = "Invalid two-factor code"
+
+// ErrTwoFactorNotConfigured error const
+const ErrTwoFactorNotConfigured = "Two-factor authentication is not configured"
+
+// ErrInvalidMFAToken error const for unknown, expired or already used mfa tokens
+const ErrInvalidMFAToken = "Invalid or expired MFA token"
+
+// DefaultTwoFactorIssuer used when Server.TwoFactorIssuer is not set
+const DefaultTwoFactorIssuer = "golang_api"
+
+// MFATokenTTL is how long the password step of a two-factor login stays valid
+const MFATokenTTL = 5 * time.Minute
+
+// MaxMFACodeAttempts codes may be given with one mfa token before it is revoked,
+// whether or not logins are throttled
+const MaxMFACodeAttempts = 5
+
+// recoveryCodeCount codes are issued when two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+const mfaPendingPurpose = "mfa-pending"
+
+// EnrollmentModel response struct with the secret to add to an authenticator app
+type EnrollmentModel struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorCodeModel model struct
+type TwoFactorCodeModel struct {
+	Code string
+}
+
+// DisableTwoFactorModel model struct
+type DisableTwoFactorModel struct {
+	Password string
+}
+
+// RecoveryCodesModel response struct, the codes are shown once and stored hashed
+type RecoveryCodesModel struct {
+	RecoveryCodes []string
+}
+
+// MFAChallengeModel response struct for logins waiting for the second factor
+type MFAChallengeModel struct {
+	MFARequired bool
+	MFAToken    string
+}
+
+// MFALoginModel model struct, either a code or a recovery code completes the login
+type MFALoginModel struct {
+	MFAToken     string
+	Code         string
+	RecoveryCode string
+}
+
+// handleEnrollTwoFactor starts enrollment with a new secret, replacing any unconfirmed one
+func handleEnrollTwoFactor(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.TwoFactors == nil {
+		respondWithError(w, http.StatusNotFound, ErrTwoFactorNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+
+	current, err := u.TwoFactors.getTwoFactor(user.Email)
+	if err != nil && err != ErrTwoFactorNotFound {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if current.Enabled {
+		respondWithError(w, http.StatusConflict, ErrTwoFactorEnabled)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.TwoFactors.saveTwoFactor(user.Email, TwoFactor{Secret: secret}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(EnrollmentModel{Secret: secret, URI: totpURI(u.twoFactorIssuer(), user.Email, secret)})
+}
+
+// handleConfirmTwoFactor enables two-factor authentication once the first code
+// matches, responding with the recovery codes
+func handleConfirmTwoFactor(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.TwoFactors == nil {
+		respondWithError(w, http.StatusNotFound, ErrTwoFactorNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+
+	var confirm TwoFactorCodeModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&confirm)
+	}
+
+	if confirm.Code == "" {
+		err := ErrMissingParam("Code")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	pending, err := u.TwoFactors.getTwoFactor(user.Email)
+	if err == ErrTwoFactorNotFound {
+		respondWithError(w, http.StatusConflict, ErrTwoFactorNotEnrolled)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if pending.Enabled {
+		respondWithError(w, http.StatusConflict, ErrTwoFactorEnabled)
+		return
+	}
+
+	counter, ok := matchTOTP(pending.Secret, confirm.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidTwoFactorCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes(u)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	enabled := TwoFactor{Secret: pending.Secret, Enabled: true, RecoveryCodes: hashes, LastCounter: counter}
+	if err := u.TwoFactors.saveTwoFactor(user.Email, enabled); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesModel{RecoveryCodes: codes})
+}
+
+// handleDisableTwoFactor turns two-factor authentication off after the user reauthenticates
+func handleDisableTwoFactor(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.TwoFactors == nil {
+		respondWithError(w, http.StatusNotFound, ErrTwoFactorNotConfigured)
+		return
+	}
+
+	user, _ := AuthenticatedUser(req.Context())
+
+	var disable DisableTwoFactorModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&disable)
+	}
+
+	if !reauthenticated(u, w, req, user, disable.Password) {
+		return
+	}
+
+	if err := u.TwoFactors.deleteTwoFactor(user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWithMFAChallenge answers a correct password with a short lived token
+// that only the second login step accepts
+func respondWithMFAChallenge(u *Server, w http.ResponseWriter, user DatabaseModel) {
+	token, err := u.Signer.Sign(signer.Claims{
+		Subject:   user.Email,
+		Purpose:   mfaPendingPurpose,
+		ExpiresAt: time.Now().Add(MFATokenTTL).Unix(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MFAChallengeModel{MFARequired: true, MFAToken: token})
+}
+
+// handleLoginTwoFactor completes a login started with a correct password, taking
+// a code from the authenticator app or an unused recovery code
+func handleLoginTwoFactor(u *Server, w http.ResponseWriter, req *http.Request) {
+	if u.TwoFactors == nil {
+		respondWithError(w, http.StatusNotFound, ErrTwoFactorNotConfigured)
+		return
+	}
+
+	var login MFALoginModel
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&login)
+	}
+
+	missingParams := ErrMissingParam(checkMissingMFAParams(login))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	claims, verifyErr := u.Verifier.Verify(login.MFAToken)
+	if verifyErr != nil || claims.Purpose != mfaPendingPurpose {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	email, ip := claims.Subject, clientIP(req)
+	if throttled(u, w, email, ip) {
+		return
+	}
+
+	dbUser, findErr := u.Store.findByEmail(email)
+	if findErr == ErrUserNotFound {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	twoFactor, err := u.TwoFactors.getTwoFactor(email)
+	if err != nil && err != ErrTwoFactorNotFound {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if !twoFactor.Enabled {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	reserved, err := u.TwoFactors.reserveCodeAttempt(email, claims.ID, MaxMFACodeAttempts)
+	if err != nil && err != ErrTwoFactorNotFound {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if !reserved {
+		if err := u.Revoker.Revoke(claims); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	updated, ok := useSecondFactor(u, twoFactor, login)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidTwoFactorCode)
+		return
+	}
+
+	if !attemptPassed(u, w, email, ip) {
+		return
+	}
+
+	if err := u.TwoFactors.saveTwoFactor(email, updated); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.Revoker.Revoke(claims); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	completeLogin(u, w, dbUser)
+}
+
+// useSecondFactor delivers the settings with the code consumed when it is valid.
+// Codes from a time step already used and spent recovery codes are rejected
+func useSecondFactor(u *Server, twoFactor TwoFactor, login MFALoginModel) (TwoFactor, bool) {
+	if login.Code != "" {
+		counter, ok := matchTOTP(twoFactor.Secret, login.Code, time.Now())
+		if !ok || counter <= twoFactor.LastCounter {
+			return twoFactor, false
+		}
+
+		twoFactor.LastCounter = counter
+		return twoFactor, true
+	}
+
+	code := normalizeRecoveryCode(login.RecoveryCode)
+	for index, hash := range twoFactor.RecoveryCodes {
+		if u.Encrypter.Compare(hash, code) == nil {
+			remaining := append([]string{}, twoFactor.RecoveryCodes[:index]...)
+			twoFactor.RecoveryCodes = append(remaining, twoFactor.RecoveryCodes[index+1:]...)
+			return twoFactor, true
+		}
+	}
+	return twoFactor, false
+}
+
+// newRecoveryCodes delivers codes formatted for reading, along with their hashes
+func newRecoveryCodes(u *Server) (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := newTOTPSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := secret[:8]
+		hash, err := u.Encrypter.Encrypt(code)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func (u *Server) twoFactorIssuer() string {
+	if u.TwoFactorIssuer == "" {
+		return DefaultTwoFactorIssuer
+	}
+	return u.TwoFactorIssuer
+}
+
+func checkMissingMFAParams(login MFALoginModel) (missingParams string) {
+	if login.MFAToken == "" {
+		missingParams += "MFAToken, "
+	}
+
+	if login.Code == "" && login.RecoveryCode == "" {
+		missingParams += "Code, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTwoFactorNotFound delivered by stores when the user never enrolled
+var ErrTwoFactorNotFound = errors.New("Two-factor settings not found")
+
+// TwoFactor TOTP settings of a user. The secret is pending until Enabled, recovery
+// codes are stored hashed and LastCounter keeps a code from being used twice.
+// CodeAttempts counts the codes given with MFATokenID, the latest mfa token tried
+type TwoFactor struct {
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string
+	LastCounter   int64
+	MFATokenID    string
+	CodeAttempts  int
+}
+
+// TwoFactorStore two-factor settings store interface, keyed by email
+type TwoFactorStore interface {
+	getTwoFactor(email string) (TwoFactor, error)
+	saveTwoFactor(email string, twoFactor TwoFactor) error
+	deleteTwoFactor(email string) error
+	reserveCodeAttempt(email string, mfaTokenID string, max int) (bool, error)
+}
+
+// InMemoryTwoFactorStore storage
+type InMemoryTwoFactorStore struct {
+	mu       sync.Mutex
+	Settings map[string]TwoFactor
+}
+
+func (i *InMemoryTwoFactorStore) getTwoFactor(email string) (TwoFactor, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	twoFactor, ok := i.Settings[email]
+	if !ok {
+		return TwoFactor{}, ErrTwoFactorNotFound
+	}
+	return twoFactor, nil
+}
+
+func (i *InMemoryTwoFactorStore) saveTwoFactor(email string, twoFactor TwoFactor) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.Settings == nil {
+		i.Settings = map[string]TwoFactor{}
+	}
+	i.Settings[email] = twoFactor
+	return nil
+}
+
+// reserveCodeAttempt counts a code given with the mfa token unless max were already
+// given with it, in one step so concurrent guesses can't all pass the check
+func (i *InMemoryTwoFactorStore) reserveCodeAttempt(email string, mfaTokenID string, max int) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	twoFactor, ok := i.Settings[email]
+	if !ok {
+		return false, ErrTwoFactorNotFound
+	}
+
+	if twoFactor.MFATokenID != mfaTokenID {
+		twoFactor.MFATokenID, twoFactor.CodeAttempts = mfaTokenID, 0
+	}
+	if twoFactor.CodeAttempts >= max {
+		return false, nil
+	}
+
+	twoFactor.CodeAttempts++
+	i.Settings[email] = twoFactor
+	return true, nil
+}
+
+func (i *InMemoryTwoFactorStore) deleteTwoFactor(email string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.Settings, email)
+	return nil
+}
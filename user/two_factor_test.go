@@ -0,0 +1,380 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestEnrollTwoFactor(t *testing.T) {
+	t.Run("Delivers 404 status code on every route without a two-factor store", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.TwoFactors = nil
+		store.foundUser = makeCurrentUser()
+
+		for _, path := range []string{"/users/2fa/enroll", "/users/2fa/confirm", "/users/2fa/disable", "/users/login/2fa"} {
+			response := makeAuthenticatedPost(t, sut, path, `{"code": "123456", "mfaToken": "any-token"}`)
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrTwoFactorNotConfigured)
+		}
+	})
+
+	t.Run("Delivers a pending secret and its otpauth URI", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/enroll", "")
+
+		var got EnrollmentModel
+		json.NewDecoder(response.Body).Decode(&got)
+		stored, _ := sut.TwoFactors.getTwoFactor("email@mail.com")
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, stored.Secret, got.Secret)
+		assertPrefix(t, got.URI, "otpauth://totp/golang_api:email@mail.com?")
+
+		if stored.Enabled {
+			t.Errorf("got enabled, want pending until confirmed")
+		}
+	})
+
+	t.Run("Delivers 409 status code when already enabled", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		enableTwoFactor(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/enroll", "")
+
+		assertStatusCode(t, response.Code, http.StatusConflict)
+		assertError(t, response.Body.String(), ErrTwoFactorEnabled)
+	})
+}
+
+func TestConfirmTwoFactor(t *testing.T) {
+	t.Run("Delivers 409 status code before enrolling", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/confirm", `{"code": "123456"}`)
+
+		assertStatusCode(t, response.Code, http.StatusConflict)
+		assertError(t, response.Body.String(), ErrTwoFactorNotEnrolled)
+	})
+
+	t.Run("Delivers 422 status code on wrong code", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		sut.TwoFactors.saveTwoFactor("email@mail.com", TwoFactor{Secret: testTOTPSecret})
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/confirm", codeBody(currentCode(t, 5)))
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("Enables two-factor and delivers recovery codes stored hashed", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		encrypter.respondWith("hashed_code")
+		store.foundUser = makeCurrentUser()
+		sut.TwoFactors.saveTwoFactor("email@mail.com", TwoFactor{Secret: testTOTPSecret})
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/confirm", codeBody(currentCode(t, 0)))
+
+		var got RecoveryCodesModel
+		json.NewDecoder(response.Body).Decode(&got)
+		stored, _ := sut.TwoFactors.getTwoFactor("email@mail.com")
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertCalls(t, len(got.RecoveryCodes), recoveryCodeCount)
+		assertCalls(t, len(stored.RecoveryCodes), recoveryCodeCount)
+		assertString(t, stored.RecoveryCodes[0], "hashed_code")
+		assertString(t, encrypter.encryptParam, normalizeRecoveryCode(got.RecoveryCodes[recoveryCodeCount-1]))
+
+		if !stored.Enabled || stored.LastCounter < totpCounter(time.Now())-1 {
+			t.Errorf("got %v, want enabled with the confirmed code spent", stored)
+		}
+	})
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	t.Run("Delivers 403 on wrong password", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		encrypter.compareError = errors.New("mismatch")
+		enableTwoFactor(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/disable", `{"password": "wrong"}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		if _, err := sut.TwoFactors.getTwoFactor("email@mail.com"); err != nil {
+			t.Errorf("got %v, want two-factor kept", err)
+		}
+	})
+
+	t.Run("Removes two-factor settings", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		enableTwoFactor(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/disable", `{"password": "password123"}`)
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+		if _, err := sut.TwoFactors.getTwoFactor("email@mail.com"); err != ErrTwoFactorNotFound {
+			t.Errorf("got %v, want %v", err, ErrTwoFactorNotFound)
+		}
+	})
+
+	t.Run("Asks users without password to sign in again", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{ID: "any-id", Email: "email@mail.com", Verified: true}
+		enableTwoFactor(t, sut)
+
+		response := makeAuthenticatedPost(t, sut, "/users/2fa/disable", `{}`)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrReauthRequired)
+
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id", AuthTime: time.Now().Unix()}}
+		response = makeAuthenticatedPost(t, sut, "/users/2fa/disable", `{}`)
+
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+	})
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	makeMFASUT := func() (Server, *EncrypterSpy, *SignerSpy) {
+		sut, encrypter, store, signerSpy := makeSUT(t)
+		store.foundUser = makeCurrentUser()
+		sut.Verifier = &VerifierSpy{claims: mfaClaims()}
+		signerSpy.respondWith("signed_token")
+		enableTwoFactor(t, sut)
+		return sut, encrypter, signerSpy
+	}
+
+	t.Run("Password step delivers an mfa token instead of a session", func(t *testing.T) {
+		sut, _, signerSpy := makeMFASUT()
+		sut.Throttle, _ = makeThrottle(t)
+		recordFailures(t, sut.Throttle, "email@mail.com", "1.1.1.1", 2)
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		var got MFAChallengeModel
+		json.NewDecoder(response.Body).Decode(&got)
+		attempts, _ := sut.Throttle.attempts("email@mail.com")
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, got.MFAToken, "signed_token")
+		assertString(t, signerSpy.signedClaims.Purpose, mfaPendingPurpose)
+		assertCalls(t, len(sut.RefreshTokens.(*InMemoryRefreshTokenStore).Tokens), 0)
+		assertCalls(t, attempts.Failures, 2)
+
+		if !got.MFARequired {
+			t.Errorf("got %v, want MFARequired", got)
+		}
+	})
+
+	t.Run("Delivers 422 status code and missing params", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+
+		response := makeRequestForMFALogin(t, sut, `{}`)
+
+		want := ErrMissingParam("MFAToken, Code")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Delivers 401 for tokens of another purpose", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id"}}
+
+		response := makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 0)))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidMFAToken)
+	})
+
+	t.Run("Delivers a session for a valid code and spends the mfa token", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+
+		response := makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 0)))
+
+		session := decodeSession(t, response.Body.String())
+		revoker := sut.Revoker.(*RevokerSpy)
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, session.Token, "signed_token")
+		assertRefreshTokenIssued(t, sut, response.Body.String(), "email@mail.com")
+		assertCalls(t, len(revoker.revokedClaims), 1)
+		assertString(t, revoker.revokedClaims[0].Purpose, mfaPendingPurpose)
+	})
+
+	t.Run("Rejects a code used before", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+		code := currentCode(t, 0)
+		makeRequestForMFALogin(t, sut, mfaBody(code))
+
+		response := makeRequestForMFALogin(t, sut, mfaBody(code))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("Counts wrong codes towards the lockout", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+		sut.Throttle, _ = makeThrottle(t)
+
+		for i := 0; i < 4; i++ {
+			makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 5)))
+		}
+		response := makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 0)))
+
+		assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Revokes the mfa token after too many wrong codes without a throttle", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+
+		for i := 0; i < MaxMFACodeAttempts; i++ {
+			makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 5)))
+		}
+		response := makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 0)))
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidMFAToken)
+		assertCalls(t, len(revoker.revokedClaims), 1)
+		assertString(t, revoker.revokedClaims[0].ID, "mfa-id")
+	})
+
+	t.Run("Counts wrong codes afresh for a new mfa token", func(t *testing.T) {
+		sut, _, _ := makeMFASUT()
+		for i := 0; i < MaxMFACodeAttempts; i++ {
+			makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 5)))
+		}
+
+		claims := mfaClaims()
+		claims.ID = "other-mfa-id"
+		sut.Verifier = &VerifierSpy{claims: claims}
+		response := makeRequestForMFALogin(t, sut, mfaBody(currentCode(t, 0)))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Accepts each recovery code once", func(t *testing.T) {
+		sut, encrypter, _ := makeMFASUT()
+		body := fmt.Sprintf(`{"mfaToken": "mfa_token", "recoveryCode": %q}`, "abcd-efgh")
+
+		response := makeRequestForMFALogin(t, sut, body)
+
+		stored, _ := sut.TwoFactors.getTwoFactor("email@mail.com")
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, encrypter.comparePassword, "ABCDEFGH")
+		assertCalls(t, len(stored.RecoveryCodes), 1)
+		assertString(t, stored.RecoveryCodes[0], "second_hash")
+	})
+
+	t.Run("Delivers 401 on unknown recovery code", func(t *testing.T) {
+		sut, encrypter, _ := makeMFASUT()
+		encrypter.compareError = errors.New("mismatch")
+
+		response := makeRequestForMFALogin(t, sut, `{"mfaToken": "mfa_token", "recoveryCode": "abcd-efgh"}`)
+
+		stored, _ := sut.TwoFactors.getTwoFactor("email@mail.com")
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertCalls(t, len(stored.RecoveryCodes), 2)
+	})
+}
+
+func TestInMemoryTwoFactorStore(t *testing.T) {
+	t.Run("Saves, delivers and deletes settings by email", func(t *testing.T) {
+		store := InMemoryTwoFactorStore{}
+
+		if _, err := store.getTwoFactor("any@mail.com"); err != ErrTwoFactorNotFound {
+			t.Errorf("got %v, want %v", err, ErrTwoFactorNotFound)
+		}
+
+		store.saveTwoFactor("any@mail.com", TwoFactor{Secret: "secret", Enabled: true})
+		got, _ := store.getTwoFactor("any@mail.com")
+		assertString(t, got.Secret, "secret")
+
+		store.deleteTwoFactor("any@mail.com")
+		if _, err := store.getTwoFactor("any@mail.com"); err != ErrTwoFactorNotFound {
+			t.Errorf("got %v, want %v", err, ErrTwoFactorNotFound)
+		}
+	})
+
+	t.Run("Lets max concurrent codes through per mfa token", func(t *testing.T) {
+		store := InMemoryTwoFactorStore{}
+		store.saveTwoFactor("any@mail.com", TwoFactor{Enabled: true})
+
+		reserved := make(chan bool, 20)
+		var wg sync.WaitGroup
+		for n := 0; n < 20; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, _ := store.reserveCodeAttempt("any@mail.com", "mfa-id", 5)
+				reserved <- ok
+			}()
+		}
+		wg.Wait()
+		close(reserved)
+
+		admitted := 0
+		for ok := range reserved {
+			if ok {
+				admitted++
+			}
+		}
+		assertCalls(t, admitted, 5)
+
+		if ok, _ := store.reserveCodeAttempt("any@mail.com", "other-mfa-id", 5); !ok {
+			t.Errorf("got refused, want a new mfa token counted afresh")
+		}
+	})
+}
+
+func enableTwoFactor(t *testing.T, sut Server) {
+	t.Helper()
+	sut.TwoFactors.saveTwoFactor("email@mail.com", TwoFactor{Secret: testTOTPSecret, Enabled: true, RecoveryCodes: []string{"first_hash", "second_hash"}})
+}
+
+// currentCode delivers the code steps time steps from now, far enough off to be rejected from 2 on
+func currentCode(t *testing.T, steps int64) string {
+	t.Helper()
+	code, err := totpCode(testTOTPSecret, totpCounter(time.Now())+steps)
+	if err != nil {
+		t.Fatalf("got %v, want code", err)
+	}
+	return code
+}
+
+func mfaClaims() signer.Claims {
+	return signer.Claims{Subject: "email@mail.com", Purpose: mfaPendingPurpose, ID: "mfa-id"}
+}
+
+func codeBody(code string) string {
+	return fmt.Sprintf(`{"code": %q}`, code)
+}
+
+func mfaBody(code string) string {
+	return fmt.Sprintf(`{"mfaToken": "mfa_token", "code": %q}`, code)
+}
+
+func makeRequestForMFALogin(t *testing.T, sut Server, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, "/users/login/2fa", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
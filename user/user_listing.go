@@ -0,0 +1,203 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultUsersPageSize is how many users are listed when no limit is given
+const DefaultUsersPageSize = 50
+
+// MaxUsersPageSize caps the limit callers may ask for
+const MaxUsersPageSize = 100
+
+// ErrInvalidParam error struct for displaying invalid param error with specified param
+type ErrInvalidParam string
+
+func (e *ErrInvalidParam) Error() string {
+	return fmt.Sprintf("Invalid parameter(s): %q", *e)
+}
+
+// UserSort field users are listed by
+type UserSort string
+
+// Supported sort fields, ties are broken by email
+const (
+	SortByCreatedAt UserSort = "created_at"
+	SortByName      UserSort = "name"
+	SortByEmail     UserSort = "email"
+)
+
+// UserQuery filters, order and page of a user listing. Empty filters match every
+// user, After resumes the listing past the cursor of the previous page's last user
+type UserQuery struct {
+	Sort       UserSort
+	Descending bool
+	Domain     string
+	Role       Role
+	Verified   *bool
+	After      *UserCursor
+	Limit      int
+}
+
+// UserCursor position of a user in a listing: its sort key, then its email
+type UserCursor struct {
+	Key   string
+	Email string
+}
+
+// UserPage users of a listing page, the count of all users matching the filters
+// and whether more follow
+type UserPage struct {
+	Users []DatabaseModel
+	Total int
+	More  bool
+}
+
+// encodedCursor is what clients get back, bound to the order it was issued for
+type encodedCursor struct {
+	Sort       UserSort `json:"s"`
+	Descending bool     `json:"d"`
+	Key        string   `json:"k"`
+	Email      string   `json:"e"`
+}
+
+// handleGetUsers lists users a page at a time, e.g. ?sort=-created_at&role=editor&limit=20.
+// The total count is sent in X-Total-Count and the next page's cursor in X-Next-Cursor
+func handleGetUsers(u *Server, w http.ResponseWriter, req *http.Request) {
+	query, invalidParams := parseUserQuery(req)
+	if invalidParams != "" {
+		err := ErrInvalidParam(invalidParams)
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	page, err := u.Store.queryUsers(query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.More && len(page.Users) > 0 {
+		w.Header().Set("X-Next-Cursor", encodeUserCursor(query, query.cursorOf(page.Users[len(page.Users)-1])))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page.Users)
+}
+
+// parseUserQuery reads the listing params, delivering the names of the invalid ones
+func parseUserQuery(req *http.Request) (query UserQuery, invalidParams string) {
+	params := req.URL.Query()
+	query = UserQuery{Sort: SortByCreatedAt, Limit: DefaultUsersPageSize}
+
+	if sort := params.Get("sort"); sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.Sort = UserSort(strings.TrimPrefix(sort, "-"))
+		if query.Sort != SortByCreatedAt && query.Sort != SortByName && query.Sort != SortByEmail {
+			invalidParams += "sort, "
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			invalidParams += "limit, "
+		} else if parsed < MaxUsersPageSize {
+			query.Limit = parsed
+		} else {
+			query.Limit = MaxUsersPageSize
+		}
+	}
+
+	query.Domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(params.Get("domain")), "@"))
+
+	if role := params.Get("role"); role != "" {
+		query.Role = Role(role)
+		if !validRole(query.Role) {
+			invalidParams += "role, "
+		}
+	}
+
+	if verified := params.Get("verified"); verified != "" {
+		parsed, err := strconv.ParseBool(verified)
+		if err != nil {
+			invalidParams += "verified, "
+		}
+		query.Verified = &parsed
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, ok := decodeUserCursor(query, cursor)
+		if !ok {
+			invalidParams += "cursor, "
+		}
+		query.After = &after
+	}
+
+	return query, strings.TrimSuffix(invalidParams, ", ")
+}
+
+func encodeUserCursor(query UserQuery, cursor UserCursor) string {
+	data, _ := json.Marshal(encodedCursor{Sort: query.Sort, Descending: query.Descending, Key: cursor.Key, Email: cursor.Email})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserCursor refuses cursors issued for another order, their position would be meaningless
+func decodeUserCursor(query UserQuery, cursor string) (UserCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return UserCursor{}, false
+	}
+
+	var decoded encodedCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Sort != query.Sort || decoded.Descending != query.Descending {
+		return UserCursor{}, false
+	}
+	return UserCursor{Key: decoded.Key, Email: decoded.Email}, true
+}
+
+// matches tells whether user passes the query's filters
+func (q UserQuery) matches(user DatabaseModel) bool {
+	if q.Domain != "" && !strings.HasSuffix(strings.ToLower(user.Email), "@"+q.Domain) {
+		return false
+	}
+	if q.Role != "" && user.Role != q.Role {
+		return false
+	}
+	if q.Verified != nil && user.Verified != *q.Verified {
+		return false
+	}
+	return true
+}
+
+// cursorOf delivers the position of user in the query's order. Keys compare as
+// strings, creation times are formatted with fixed width so they do too
+func (q UserQuery) cursorOf(user DatabaseModel) UserCursor {
+	var key string
+	switch q.Sort {
+	case SortByName:
+		key = strings.ToLower(user.Name)
+	case SortByEmail:
+		key = strings.ToLower(user.Email)
+	default:
+		key = user.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000000Z07:00")
+	}
+	return UserCursor{Key: key, Email: strings.ToLower(user.Email)}
+}
+
+// before tells whether position a is listed before b in the query's order
+func (q UserQuery) before(a UserCursor, b UserCursor) bool {
+	if a.Key != b.Key {
+		return (a.Key < b.Key) != q.Descending
+	}
+	if a.Email != b.Email {
+		return (a.Email < b.Email) != q.Descending
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"api/signer"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListUsers(t *testing.T) {
+	t.Run("Lists by creation time with the default page size", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		makeListUsersRequest(t, sut, "/users")
+
+		if store.query.Sort != SortByCreatedAt || store.query.Descending || store.query.Limit != DefaultUsersPageSize || store.query.After != nil {
+			t.Errorf("got %+v, want oldest first, %d per page", store.query, DefaultUsersPageSize)
+		}
+	})
+
+	t.Run("Passes sort and filters down to the store", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		makeListUsersRequest(t, sut, "/users?sort=-name&domain=@Mail.com&role=editor&verified=false&limit=20")
+
+		got := store.query
+		if got.Sort != SortByName || !got.Descending || got.Domain != "mail.com" || got.Role != RoleEditor || got.Limit != 20 {
+			t.Errorf("got %+v, want name descending, mail.com editors, 20 per page", got)
+		}
+
+		if got.Verified == nil || *got.Verified {
+			t.Errorf("got %v, want unverified users only", got.Verified)
+		}
+	})
+
+	t.Run("Caps the page size", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		makeListUsersRequest(t, sut, "/users?limit=5000")
+
+		assertCalls(t, store.query.Limit, MaxUsersPageSize)
+	})
+
+	t.Run("Delivers 422 status code naming the invalid params", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+
+		response := makeListUsersRequest(t, sut, "/users?sort=age&limit=0&role=owner&verified=maybe&cursor=not-a-cursor")
+
+		want := ErrInvalidParam("sort, limit, role, verified, cursor")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+
+	t.Run("Walks every page following the next cursor", func(t *testing.T) {
+		sut, store := makeListingSUT(t)
+
+		var got []string
+		path := "/users?sort=email&limit=2"
+		for pages := 0; pages < 10; pages++ {
+			response := makeListUsersRequest(t, sut, path)
+			assertStatusCode(t, response.Code, http.StatusOK)
+			assertString(t, response.Header().Get("X-Total-Count"), "5")
+
+			var users []DatabaseModel
+			json.NewDecoder(response.Body).Decode(&users)
+			for _, user := range users {
+				got = append(got, user.Email)
+			}
+
+			cursor := response.Header().Get("X-Next-Cursor")
+			if cursor == "" {
+				break
+			}
+			path = "/users?sort=email&limit=2&cursor=" + cursor
+		}
+
+		want := []string{"admin@mail.com", "ann@mail.com", "bob@mail.com", "carl@other.com", "dora@other.com"}
+		assertString(t, strings.Join(got, " "), strings.Join(want, " "))
+		assertCalls(t, len(store.Users), 5)
+	})
+
+	t.Run("Refuses cursors issued for another order", func(t *testing.T) {
+		sut, _ := makeListingSUT(t)
+		first := makeListUsersRequest(t, sut, "/users?sort=email&limit=2")
+
+		response := makeListUsersRequest(t, sut, "/users?sort=-email&limit=2&cursor="+first.Header().Get("X-Next-Cursor"))
+
+		want := ErrInvalidParam("cursor")
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertError(t, response.Body.String(), want.Error())
+	})
+}
+
+func makeListingSUT(t *testing.T) (Server, *InMemoryUsersStore) {
+	t.Helper()
+	sut, _, _, _ := makeSUT(t)
+	sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "admin-id"}}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &InMemoryUsersStore{Users: []DatabaseModel{
+		{Name: "Dora", Email: "dora@other.com", Role: RoleMember, CreatedAt: created},
+		{ID: "admin-id", Name: "Admin", Email: "admin@mail.com", Role: RoleAdmin, Verified: true, CreatedAt: created.Add(time.Hour)},
+		{Name: "bob", Email: "bob@mail.com", Role: RoleEditor, Verified: true, CreatedAt: created.Add(2 * time.Hour)},
+		{Name: "Carl", Email: "carl@other.com", Role: RoleMember, Verified: true, CreatedAt: created.Add(3 * time.Hour)},
+		{Name: "ann", Email: "ann@mail.com", Role: RoleMember, CreatedAt: created.Add(4 * time.Hour)},
+	}}
+	sut.Store = store
+	return sut, store
+}
+
+func makeListUsersRequest(t *testing.T, sut Server, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer any-token")
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
@@ -2,10 +2,18 @@ package user
 
 import (
 	"api/encryption"
+	"api/mailer"
 	"api/signer"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/mail"
+	"path"
+	"strings"
+	"time"
 )
 
 // ErrInternalServer error const
@@ -14,6 +22,30 @@ const ErrInternalServer = "Internal server error"
 // ErrPasswordsDontMatch error const
 const ErrPasswordsDontMatch = "Passwords don't match"
 
+// ErrInvalidEmail error const
+const ErrInvalidEmail = "Invalid email"
+
+// ErrEmailTaken error const
+const ErrEmailTaken = "Email already registered"
+
+// ErrInvalidCredentials error const, shared by unknown emails and wrong passwords
+const ErrInvalidCredentials = "Invalid email or password"
+
+// ErrNotFound error const
+const ErrNotFound = "Not found"
+
+// ErrUserNotFound delivered by stores when no user matches the lookup
+var ErrUserNotFound = errors.New("User not found")
+
+// ErrUserAlreadyExists delivered by stores when saving an email that is already registered
+type ErrUserAlreadyExists struct {
+	Email string
+}
+
+func (e *ErrUserAlreadyExists) Error() string {
+	return fmt.Sprintf("User with email %q already exists", e.Email)
+}
+
 // ErrMissingParam error struct for displaying missing param error with specified param
 type ErrMissingParam string
 
@@ -21,11 +53,17 @@ func (e *ErrMissingParam) Error() string {
 	return fmt.Sprintf("Missing parameter(s): %q", *e)
 }
 
-// DatabaseModel user struct
+// DatabaseModel user struct, ID never changes nor is reassigned so access tokens
+// name users by it while the email may change
 type DatabaseModel struct {
-	Name     string
-	Email    string
-	password string
+	ID        string
+	Name      string
+	Email     string
+	Role      Role
+	Verified  bool
+	CreatedAt time.Time
+	password  string
+	deleteAt  time.Time
 }
 
 // RegisterModel model struct
@@ -36,28 +74,173 @@ type RegisterModel struct {
 	PasswordConfirm string
 }
 
+// LoginModel model struct
+type LoginModel struct {
+	Email    string
+	Password string
+}
+
 // Store user store interface
 type Store interface {
 	save(user DatabaseModel) error
 	getAll() ([]DatabaseModel, error)
+	queryUsers(query UserQuery) (UserPage, error)
+	findByEmail(email string) (DatabaseModel, error)
+	findByID(id string) (DatabaseModel, error)
+	updatePassword(email string, hash string) error
+	setVerified(email string, verified bool) error
+	setRole(email string, role Role) error
+	updateProfile(email string, user DatabaseModel) error
+	scheduleDeletion(email string, at time.Time) error
+	delete(email string) error
 }
 
 // Server struct
 type Server struct {
-	Encrypter encryption.Encrypter
-	Store     Store
-	Signer    signer.Signer
+	Encrypter        encryption.Encrypter
+	Store            Store
+	Signer           signer.Signer
+	Verifier         signer.Verifier
+	Revoker          signer.Revoker
+	RefreshTokens    RefreshTokenStore
+	RefreshTokenTTL  time.Duration
+	PasswordPolicy   PasswordValidator
+	Throttle         *LoginThrottle
+	Mailer           mailer.Mailer
+	BaseURL          string
+	VerificationTTL  time.Duration
+	PasswordResets   PasswordResetStore
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+	DeletionGrace    time.Duration
+	ReauthWindow     time.Duration
+	PersonalData     map[string]PersonalData
+	TwoFactors       TwoFactorStore
+	TwoFactorIssuer  string
+	APIKeys          APIKeyStore
+	OIDC             *OIDCProvider
+	OIDCStates       OIDCStateStore
+
+	// background runs work the response should not wait for, in a goroutine when nil
+	background func(task func())
+}
+
+// route of the users server, authenticated ones need a login and pass usersPolicy
+type route struct {
+	handle        func(*Server, http.ResponseWriter, *http.Request)
+	authenticated bool
+}
+
+// usersPolicy declares the roles of the authenticated routes, the others only need a login
+var usersPolicy = Policy{
+	http.MethodGet + " /users":                  {Roles: []Role{RoleAdmin}},
+	http.MethodPost + " /users/unlock":          {Roles: []Role{RoleAdmin}},
+	http.MethodPost + " /users/sessions/revoke": {Roles: []Role{RoleAdmin}},
+	http.MethodPost + " /users/role":            {Roles: []Role{RoleAdmin}},
+}
+
+// routes keyed by method and path, a * path segment matches any single segment
+var routes = map[string]route{
+	http.MethodGet + " /users":                  {handle: handleGetUsers, authenticated: true},
+	http.MethodPost + " /users":                 {handle: handlePostUser},
+	http.MethodPost + " /users/login":           {handle: handleLogin},
+	http.MethodPost + " /users/login/2fa":       {handle: handleLoginTwoFactor},
+	http.MethodGet + " /users/oidc/login":       {handle: handleOIDCLogin},
+	http.MethodGet + " /users/oidc/callback":    {handle: handleOIDCCallback},
+	http.MethodPost + " /users/token/refresh":   {handle: handleRefreshToken},
+	http.MethodPost + " /users/logout":          {handle: handleLogout, authenticated: true},
+	http.MethodGet + " /users/verify":           {handle: handleVerifyEmail},
+	http.MethodPost + " /users/verify/resend":   {handle: handleResendVerification, authenticated: true},
+	http.MethodPost + " /users/password/forgot": {handle: handleForgotPassword},
+	http.MethodGet + " /users/password/reset":   {handle: handleResetPasswordForm},
+	http.MethodPost + " /users/password/reset":  {handle: handleResetPassword},
+	http.MethodPatch + " /users/me":             {handle: handleUpdateProfile, authenticated: true},
+	http.MethodDelete + " /users/me":            {handle: handleDeleteAccount, authenticated: true},
+	http.MethodGet + " /users/userinfo":         {handle: handleUserinfo, authenticated: true},
+	http.MethodGet + " /users/me/export":        {handle: handleExportData, authenticated: true},
+	http.MethodPost + " /users/2fa/enroll":      {handle: handleEnrollTwoFactor, authenticated: true},
+	http.MethodPost + " /users/2fa/confirm":     {handle: handleConfirmTwoFactor, authenticated: true},
+	http.MethodPost + " /users/2fa/disable":     {handle: handleDisableTwoFactor, authenticated: true},
+	http.MethodPost + " /users/me/api-keys":     {handle: handleCreateAPIKey, authenticated: true},
+	http.MethodGet + " /users/me/api-keys":      {handle: handleListAPIKeys, authenticated: true},
+	http.MethodDelete + " /users/me/api-keys/*": {handle: handleRevokeAPIKey, authenticated: true},
+	http.MethodPut + " /users/me/password":      {handle: handleChangePassword, authenticated: true},
+	http.MethodPost + " /users/unlock":          {handle: handleUnlock, authenticated: true},
+	http.MethodPost + " /users/sessions/revoke": {handle: handleRevokeSessions, authenticated: true},
+	http.MethodPost + " /users/role":            {handle: handleSetRole, authenticated: true},
 }
 
+// ServeHTTP responds 404 on unknown paths and 405 on methods a known path doesn't serve
 func (u *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.Method == http.MethodGet {
-		handleGetUsers(w, u.Store)
-	} else {
-		handlePostUser(w, req, u.Store, u.Encrypter, u.Signer)
+	route, ok, known := routeFor(req.Method, req.URL.Path)
+	if !ok {
+		if known {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		respondWithError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	handler := u.handlerFunc(route.handle)
+	if route.authenticated {
+		handler = u.authenticator().Authorize(usersPolicy, handler)
 	}
+	handler.ServeHTTP(w, req)
 }
 
-func handlePostUser(w http.ResponseWriter, req *http.Request, store Store, encryptor encryption.Encrypter, signer signer.Signer) {
+// routeFor delivers the route matching method and requestPath, and whether any
+// method is routed on requestPath
+func routeFor(method string, requestPath string) (found route, ok bool, known bool) {
+	for key, candidate := range routes {
+		parts := strings.SplitN(key, " ", 2)
+		if matched, _ := path.Match(parts[1], requestPath); !matched {
+			continue
+		}
+		known = true
+		if parts[0] == method {
+			return candidate, true, true
+		}
+	}
+	return route{}, false, known
+}
+
+// inBackground runs task without holding up the response, a panicking task is
+// logged rather than taking the whole process down
+func (u *Server) inBackground(task func()) {
+	if u.background != nil {
+		u.background(task)
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("background task failed: %v", r)
+			}
+		}()
+		task()
+	}()
+}
+
+func (u *Server) authenticator() *Authenticator {
+	return &Authenticator{Verifier: u.Verifier, Store: u.Store}
+}
+
+func (u *Server) passwordPolicy() PasswordValidator {
+	if u.PasswordPolicy == nil {
+		return DefaultPasswordPolicy
+	}
+	return u.PasswordPolicy
+}
+
+func (u *Server) handlerFunc(handler func(*Server, http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler(u, w, req)
+	})
+}
+
+func handlePostUser(u *Server, w http.ResponseWriter, req *http.Request) {
 	if req.Body == nil {
 		err := ErrMissingParam("Name, Email, Password, PasswordConfirm")
 		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
@@ -73,53 +256,192 @@ func handlePostUser(w http.ResponseWriter, req *http.Request, store Store, encry
 		return
 	}
 
+	user.Email = normalizeEmail(user.Email)
+	if !validEmail(user.Email) {
+		respondWithError(w, http.StatusUnprocessableEntity, ErrInvalidEmail)
+		return
+	}
+
 	if user.Password != user.PasswordConfirm {
 		respondWithError(w, http.StatusUnprocessableEntity, ErrPasswordsDontMatch)
 		return
 	}
 
-	hashed, hashErr := encryptor.Encrypt(user.Password, 10)
+	if reasons := u.passwordPolicy().Validate(user.Password, user.Name, user.Email); len(reasons) > 0 {
+		respondWithPolicyViolation(w, reasons)
+		return
+	}
+
+	hashed, hashErr := u.Encrypter.Encrypt(user.Password)
 
 	if hashErr != nil {
 		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
 		return
 	}
 
-	dbUser := DatabaseModel{Name: user.Name, Email: user.Email, password: hashed}
-	storeErr := store.save(dbUser)
+	id, idErr := newUserID()
+
+	if idErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	dbUser := DatabaseModel{ID: id, Name: user.Name, Email: user.Email, Role: RoleMember, CreatedAt: time.Now().UTC(), password: hashed}
+	storeErr := u.Store.save(dbUser)
+
+	var alreadyExists *ErrUserAlreadyExists
+	if errors.As(storeErr, &alreadyExists) {
+		respondWithError(w, http.StatusConflict, ErrEmailTaken)
+		return
+	}
 
 	if storeErr != nil {
 		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
 		return
 	}
 
-	token, signerErr := signer.Sign()
+	session, sessionErr := issueSession(u, dbUser, "", time.Now())
 
-	if signerErr != nil {
+	if sessionErr != nil {
 		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
 		return
 	}
 
-	signedUser := struct {
-		User  DatabaseModel
-		Token string
-	}{dbUser, token}
+	// The account already exists, a failed email can be sent again through the resend endpoint
+	sendVerificationEmail(u, dbUser)
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(signedUser)
+	json.NewEncoder(w).Encode(session)
 }
 
-func handleGetUsers(w http.ResponseWriter, store Store) {
-	users, err := store.getAll()
+func handleLogin(u *Server, w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		err := ErrMissingParam("Email, Password")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, ErrInternalServer)
-	} else {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(users)
+	var login LoginModel
+	json.NewDecoder(req.Body).Decode(&login)
+
+	missingParams := ErrMissingParam(checkMissingLoginParams(login))
+	if missingParams != "" {
+		respondWithError(w, http.StatusUnprocessableEntity, missingParams.Error())
+		return
+	}
+
+	email, ip := normalizeEmail(login.Email), clientIP(req)
+
+	if throttled(u, w, email, ip) {
+		return
+	}
+
+	dbUser, findErr := u.Store.findByEmail(email)
+
+	if findErr == ErrUserNotFound {
+		// Hashing costs as much as comparing, so unknown emails can't be told apart by timing
+		u.Encrypter.Encrypt(login.Password)
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidCredentials)
+		return
+	}
+
+	if findErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if compareErr := u.Encrypter.Compare(dbUser.password, login.Password); compareErr != nil {
+		respondWithError(w, http.StatusUnauthorized, ErrInvalidCredentials)
+		return
+	}
+
+	if !attemptPassed(u, w, email, ip) {
+		return
+	}
+
+	if u.Encrypter.NeedsRehash(dbUser.password) {
+		// Failing to upgrade the hash must not fail the login, it is retried next time
+		if hashed, hashErr := u.Encrypter.Encrypt(login.Password); hashErr == nil {
+			if u.Store.updatePassword(dbUser.Email, hashed) == nil {
+				dbUser.password = hashed
+			}
+		}
+	}
+
+	respondWithSessionOrChallenge(u, w, dbUser)
+}
+
+// respondWithSessionOrChallenge completes the login of a user whose first factor
+// passed, or asks for the second one when two-factor authentication is enabled
+func respondWithSessionOrChallenge(u *Server, w http.ResponseWriter, dbUser DatabaseModel) {
+	if u.TwoFactors != nil {
+		twoFactor, err := u.TwoFactors.getTwoFactor(dbUser.Email)
+		if err != nil && err != ErrTwoFactorNotFound {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+
+		// Failures are only cleared once the second factor passes too, so codes can't be guessed indefinitely
+		if twoFactor.Enabled {
+			respondWithMFAChallenge(u, w, dbUser)
+			return
+		}
+	}
+
+	completeLogin(u, w, dbUser)
+}
+
+// completeLogin clears failed attempts and a pending deletion, then responds with a new session
+func completeLogin(u *Server, w http.ResponseWriter, dbUser DatabaseModel) {
+	if u.Throttle != nil {
+		if err := u.Throttle.recordSuccess(dbUser.Email); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+	}
+
+	if !dbUser.deleteAt.IsZero() {
+		// Logging in during the grace period keeps the account
+		if err := u.Store.scheduleDeletion(dbUser.Email, time.Time{}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+			return
+		}
+	}
+
+	session, sessionErr := issueSession(u, dbUser, "", time.Now())
+
+	if sessionErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
 	}
 
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(session)
+}
+
+func claimsFor(user DatabaseModel) signer.Claims {
+	return signer.Claims{Subject: user.ID, Name: user.Name, Role: string(user.Role)}
+}
+
+// newUserID generates a random (version 4) UUID
+func newUserID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+// normalizeEmail makes emails differing only in case or surrounding spaces the same user
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && strings.Contains(email[strings.LastIndex(email, "@"):], ".")
 }
 
 func respondWithError(w http.ResponseWriter, status int, err string) {
@@ -149,3 +471,18 @@ func checkMissingParams(user RegisterModel) (missingParams string) {
 	}
 	return
 }
+
+func checkMissingLoginParams(login LoginModel) (missingParams string) {
+	if login.Email == "" {
+		missingParams += "Email, "
+	}
+
+	if login.Password == "" {
+		missingParams += "Password, "
+	}
+
+	if missingParams != "" {
+		missingParams = missingParams[:len(missingParams)-2]
+	}
+	return
+}
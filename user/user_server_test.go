@@ -1,13 +1,16 @@
 package user
 
 import (
+	"api/signer"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 type EncrypterSpy struct {
@@ -15,14 +18,28 @@ type EncrypterSpy struct {
 	encryptParam    string
 	defaultPassword string
 	defaultError    error
+	compareHash     string
+	comparePassword string
+	compareError    error
+	needsRehash     bool
 }
 
-func (e *EncrypterSpy) Encrypt(password string, cost int) (string, error) {
+func (e *EncrypterSpy) Encrypt(password string) (string, error) {
 	e.calls++
 	e.encryptParam = password
 	return e.defaultPassword, e.defaultError
 }
 
+func (e *EncrypterSpy) Compare(hash string, password string) error {
+	e.compareHash = hash
+	e.comparePassword = password
+	return e.compareError
+}
+
+func (e *EncrypterSpy) NeedsRehash(hash string) bool {
+	return e.needsRehash
+}
+
 func (e *EncrypterSpy) respondWith(password string) {
 	e.defaultPassword = password
 }
@@ -36,6 +53,22 @@ type UserStoreSpy struct {
 	saveUserParams DatabaseModel
 	defaultError   error
 	Users          []DatabaseModel
+	findEmailParam string
+	findIDParam    string
+	foundUser      DatabaseModel
+	findError      error
+	updatedEmail   string
+	updatedHash    string
+	updateError    error
+	verifiedEmail  string
+	profileEmail   string
+	profileUpdate  DatabaseModel
+	deletionEmail  string
+	deletionAt     time.Time
+	deletedEmails  []string
+	roleEmail      string
+	role           Role
+	query          UserQuery
 }
 
 func (e *UserStoreSpy) save(user DatabaseModel) error {
@@ -48,6 +81,55 @@ func (e *UserStoreSpy) getAll() ([]DatabaseModel, error) {
 	return e.Users, e.defaultError
 }
 
+func (e *UserStoreSpy) queryUsers(query UserQuery) (UserPage, error) {
+	e.query = query
+	return UserPage{Users: e.Users, Total: len(e.Users)}, e.defaultError
+}
+
+func (e *UserStoreSpy) findByEmail(email string) (DatabaseModel, error) {
+	e.findEmailParam = email
+	return e.foundUser, e.findError
+}
+
+func (e *UserStoreSpy) findByID(id string) (DatabaseModel, error) {
+	e.findIDParam = id
+	return e.foundUser, e.findError
+}
+
+func (e *UserStoreSpy) updatePassword(email string, hash string) error {
+	e.updatedEmail = email
+	e.updatedHash = hash
+	return e.updateError
+}
+
+func (e *UserStoreSpy) setVerified(email string, verified bool) error {
+	e.verifiedEmail = email
+	return e.updateError
+}
+
+func (e *UserStoreSpy) setRole(email string, role Role) error {
+	e.roleEmail = email
+	e.role = role
+	return e.updateError
+}
+
+func (e *UserStoreSpy) updateProfile(email string, user DatabaseModel) error {
+	e.profileEmail = email
+	e.profileUpdate = user
+	return e.updateError
+}
+
+func (e *UserStoreSpy) scheduleDeletion(email string, at time.Time) error {
+	e.deletionEmail = email
+	e.deletionAt = at
+	return e.updateError
+}
+
+func (e *UserStoreSpy) delete(email string) error {
+	e.deletedEmails = append(e.deletedEmails, email)
+	return e.updateError
+}
+
 func (e *UserStoreSpy) respondGetAllWith(users []DatabaseModel) {
 	e.Users = users
 }
@@ -59,13 +141,15 @@ func (e *UserStoreSpy) respondWithError(err error) {
 type SignerSpy struct {
 	defaultError error
 	defaultToken string
+	signedClaims signer.Claims
 }
 
 func (s *SignerSpy) respondWith(token string) {
 	s.defaultToken = token
 }
 
-func (s *SignerSpy) Sign() (string, error) {
+func (s *SignerSpy) Sign(claims signer.Claims) (string, error) {
+	s.signedClaims = claims
 	return s.defaultToken, s.defaultError
 }
 
@@ -139,6 +223,38 @@ func TestRegister(t *testing.T) {
 		assertString(t, got.password, wantedEncryptedPassword)
 	})
 
+	t.Run("Stores email trimmed and lower cased", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		body := `{"name":"any-name", "email": " Email@Mail.COM ", "password": "password123", "passwordConfirm": "password123"}`
+
+		makeRequestForRegistration(t, sut, body)
+
+		assertString(t, store.saveUserParams.Email, "email@mail.com")
+	})
+
+	t.Run("Delivers 422 status code and ErrInvalidEmail on malformed email", func(t *testing.T) {
+		for _, email := range []string{"not-an-email", "any@", "Name <any@mail.com>", "any@mail"} {
+			sut, _, store, _ := makeSUT(t)
+			body := fmt.Sprintf(`{"name":"any-name", "email": %q, "password": "password123", "passwordConfirm": "password123"}`, email)
+
+			response := makeRequestForRegistration(t, sut, body)
+
+			assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+			assertError(t, response.Body.String(), ErrInvalidEmail)
+			assertCalls(t, store.calls, 0)
+		}
+	})
+
+	t.Run("Delivers 409 status code on already registered email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.respondWithError(&ErrUserAlreadyExists{Email: "email@mail.com"})
+
+		response := makeRequestForRegistration(t, sut, makeValidBody())
+
+		assertStatusCode(t, response.Code, http.StatusConflict)
+		assertError(t, response.Body.String(), ErrEmailTaken)
+	})
+
 	t.Run("Delivers 500 status code on store error", func(t *testing.T) {
 		sut, encrypter, store, _ := makeSUT(t)
 		store.respondWithError(errors.New("any-error"))
@@ -160,44 +276,110 @@ func TestRegister(t *testing.T) {
 		assertString(t, response.Body.String(), ErrInternalServer)
 	})
 
+	t.Run("Signs token with the registered user identity", func(t *testing.T) {
+		sut, _, store, signer := makeSUT(t)
+
+		makeRequestForRegistration(t, sut, makeValidBody())
+
+		if store.saveUserParams.ID == "" {
+			t.Errorf("got no ID, want a stable one assigned")
+		}
+		assertString(t, signer.signedClaims.Subject, store.saveUserParams.ID)
+		assertString(t, signer.signedClaims.Name, "any-name")
+		assertString(t, signer.signedClaims.Role, "member")
+	})
+
 	t.Run("Delivers 201 status code and created user without password", func(t *testing.T) {
-		sut, encrypter, _, signer := makeSUT(t)
+		sut, encrypter, store, signer := makeSUT(t)
 		encrypter.respondWith("hashed_password")
 		signer.respondWith("signed_token")
 
 		response := makeRequestForRegistration(t, sut, makeValidBody())
 
 		got := response.Body.String()
-		want := `{"User":{"Name":"any-name","Email":"email@mail.com"},"Token":"signed_token"}` + "\n"
+		want := `{"User":{"ID":"` + store.saveUserParams.ID + `","Name":"any-name","Email":"email@mail.com","Role":"member","Verified":false,"CreatedAt":"`
 
 		assertStatusCode(t, response.Code, http.StatusCreated)
-		assertString(t, got, want)
+		assertPrefix(t, got, want)
+		assertString(t, decodeSession(t, got).Token, "signed_token")
+		assertRefreshTokenIssued(t, sut, got, "email@mail.com")
+	})
+}
+
+func TestRouting(t *testing.T) {
+	t.Run("Delivers 404 status code on unknown paths without registering", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			sut, _, store, _ := makeSUT(t)
+			request, _ := http.NewRequest(method, "/users/typo", strings.NewReader(makeValidBody()))
+			response := httptest.NewRecorder()
+
+			sut.ServeHTTP(response, request)
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+			assertError(t, response.Body.String(), ErrNotFound)
+			assertCalls(t, store.calls, 0)
+		}
+	})
+
+	t.Run("Delivers 405 status code on methods a path doesn't serve", func(t *testing.T) {
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPut, "/users/me"},
+			{http.MethodDelete, "/users/logout"},
+			{http.MethodPut, "/users"},
+		} {
+			sut, _, store, _ := makeSUT(t)
+			request, _ := http.NewRequest(route.method, route.path, strings.NewReader(makeValidBody()))
+			response := httptest.NewRecorder()
+
+			sut.ServeHTTP(response, request)
+
+			assertStatusCode(t, response.Code, http.StatusMethodNotAllowed)
+			assertCalls(t, store.calls, 0)
+		}
 	})
 }
 
 func TestGetUsers(t *testing.T) {
-	t.Run("Delivers error on storage failure", func(t *testing.T) {
-		sut, _, store, _ := makeSUT(t)
-		store.respondWithError(errors.New(ErrInternalServer))
+	t.Run("Delivers 401 to anonymous callers", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
 		request, _ := http.NewRequest(http.MethodGet, "/users", nil)
 		response := httptest.NewRecorder()
 
 		sut.ServeHTTP(response, request)
 
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrUnauthorized)
+	})
+
+	t.Run("Delivers 403 to non admin users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com"}
+
+		response := makeGetUsersRequest(t, sut)
+
+		assertStatusCode(t, response.Code, http.StatusForbidden)
+		assertError(t, response.Body.String(), ErrForbidden)
+	})
+
+	t.Run("Delivers error on storage failure", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
+		store.respondWithError(errors.New(ErrInternalServer))
+
+		response := makeGetUsersRequest(t, sut)
+
 		assertStatusCode(t, response.Code, http.StatusInternalServerError)
 		assertError(t, response.Body.String(), ErrInternalServer)
 	})
 
 	t.Run("Delivers users in storage successfully", func(t *testing.T) {
 		sut, _, store, _ := makeSUT(t)
+		store.foundUser = makeAdmin()
 		want := []DatabaseModel{{Name: "any-Name", Email: "mail@mail.com", password: "any-password"}}
 		store.respondGetAllWith(want)
 		store.Users = want
 
-		request, _ := http.NewRequest(http.MethodGet, "/users", nil)
-		response := httptest.NewRecorder()
-
-		sut.ServeHTTP(response, request)
+		response := makeGetUsersRequest(t, sut)
 
 		var got []DatabaseModel
 		json.NewDecoder(response.Body).Decode(&got)
@@ -207,6 +389,139 @@ func TestGetUsers(t *testing.T) {
 	})
 }
 
+func TestLogin(t *testing.T) {
+	t.Run("Delivers 422 status code and missing param error correctly", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		testingTable := []struct {
+			body string
+			want ErrMissingParam
+		}{
+			{"", ErrMissingParam("Email, Password")},
+			{`{"password": "password123"}`, ErrMissingParam("Email")},
+			{`{"email": "email@mail.com"}`, ErrMissingParam("Password")},
+		}
+
+		for _, testCase := range testingTable {
+			response := makeRequestForLogin(t, sut, testCase.body)
+
+			assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+			assertError(t, response.Body.String(), testCase.want.Error())
+		}
+	})
+
+	t.Run("Looks up user by email and compares against stored hash", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Name: "any-name", Email: "email@mail.com", password: "hashed_password"}
+
+		makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertString(t, store.findEmailParam, "email@mail.com")
+		assertString(t, encrypter.compareHash, "hashed_password")
+		assertString(t, encrypter.comparePassword, "password123")
+	})
+
+	t.Run("Looks up user by normalized email", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+
+		makeRequestForLogin(t, sut, `{"email": " Email@Mail.com", "password": "password123"}`)
+
+		assertString(t, store.findEmailParam, "email@mail.com")
+	})
+
+	t.Run("Delivers 401 without revealing the email on unknown user", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.findError = ErrUserNotFound
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidCredentials)
+		assertCalls(t, encrypter.calls, 1)
+	})
+
+	t.Run("Delivers 401 on wrong password", func(t *testing.T) {
+		sut, encrypter, _, _ := makeSUT(t)
+		encrypter.compareError = errors.New("mismatch")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrInvalidCredentials)
+	})
+
+	t.Run("Rehashes and saves outdated hash on successful login", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", password: "outdated_hash"}
+		encrypter.needsRehash = true
+		encrypter.respondWith("rehashed_password")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertString(t, encrypter.encryptParam, "password123")
+		assertString(t, store.updatedEmail, "email@mail.com")
+		assertString(t, store.updatedHash, "rehashed_password")
+	})
+
+	t.Run("Keeps current hash untouched", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", password: "current_hash"}
+
+		makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertCalls(t, encrypter.calls, 0)
+		assertString(t, store.updatedHash, "")
+	})
+
+	t.Run("Logs in even when rehashing fails", func(t *testing.T) {
+		sut, encrypter, store, _ := makeSUT(t)
+		store.foundUser = DatabaseModel{Email: "email@mail.com", password: "outdated_hash"}
+		encrypter.needsRehash = true
+		store.updateError = errors.New("any-error")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Delivers 500 status code on store error", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		store.findError = errors.New("any-error")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+		assertError(t, response.Body.String(), ErrInternalServer)
+	})
+
+	t.Run("Delivers 500 status code on token creation failure", func(t *testing.T) {
+		sut, _, _, signer := makeSUT(t)
+		signer.defaultError = errors.New("any-error")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+		assertError(t, response.Body.String(), ErrInternalServer)
+	})
+
+	t.Run("Delivers 200 status code and signed user without password", func(t *testing.T) {
+		sut, _, store, signer := makeSUT(t)
+		createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		store.foundUser = DatabaseModel{ID: "any-id", Name: "any-name", Email: "email@mail.com", Role: RoleMember, CreatedAt: createdAt, password: "hashed_password"}
+		signer.respondWith("signed_token")
+
+		response := makeRequestForLogin(t, sut, makeValidLoginBody())
+
+		got := response.Body.String()
+		want := `{"User":{"ID":"any-id","Name":"any-name","Email":"email@mail.com","Role":"member","Verified":false,"CreatedAt":"2020-01-01T00:00:00Z"},"Token":"signed_token","RefreshToken":`
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertPrefix(t, got, want)
+		assertRefreshTokenIssued(t, sut, got, "email@mail.com")
+	})
+}
+
 func makeSUT(t *testing.T) (Server, *EncrypterSpy, *UserStoreSpy, *SignerSpy) {
 	sut := Server{}
 	encrypter := &EncrypterSpy{}
@@ -216,6 +531,14 @@ func makeSUT(t *testing.T) (Server, *EncrypterSpy, *UserStoreSpy, *SignerSpy) {
 	sut.Encrypter = encrypter
 	sut.Store = store
 	sut.Signer = signer
+	sut.Verifier = &VerifierSpy{}
+	sut.RefreshTokens = &InMemoryRefreshTokenStore{}
+	sut.Revoker = &RevokerSpy{}
+	sut.PasswordResets = &InMemoryPasswordResetStore{}
+	sut.TwoFactors = &InMemoryTwoFactorStore{}
+	sut.APIKeys = &InMemoryAPIKeyStore{}
+	sut.OIDCStates = &InMemoryOIDCStateStore{}
+	sut.background = func(task func()) { task() }
 
 	return sut, encrypter, store, signer
 }
@@ -228,6 +551,31 @@ func makeRequestForRegistration(t *testing.T, sut Server, body string) httptest.
 	return *response
 }
 
+func makeGetUsersRequest(t *testing.T, sut Server) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	request.Header.Set("Authorization", "Bearer any-token")
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}
+
+func makeAdmin() DatabaseModel {
+	return DatabaseModel{ID: "admin-id", Name: "admin", Email: "admin@mail.com", Role: RoleAdmin}
+}
+
+func makeRequestForLogin(t *testing.T, sut Server, body string) httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, "/users/login", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return *response
+}
+
+func makeValidLoginBody() string {
+	return `{"email": "email@mail.com", "password": "password123"}`
+}
+
 func makeValidBody() string {
 	return `{"name":"any-name", "email": "email@mail.com", "password": "password123", "passwordConfirm": "password123"}`
 
@@ -236,7 +584,7 @@ func makeValidBody() string {
 func assertMissingParams(t *testing.T, sut Server, body io.Reader, want string) {
 	t.Helper()
 
-	request, _ := http.NewRequest(http.MethodPost, "/register", body)
+	request, _ := http.NewRequest(http.MethodPost, "/users", body)
 	response := httptest.NewRecorder()
 
 	sut.ServeHTTP(response, request)
@@ -247,6 +595,13 @@ func assertMissingParams(t *testing.T, sut Server, body io.Reader, want string)
 	assertError(t, got, want)
 }
 
+func assertPrefix(t *testing.T, got string, prefix string) {
+	t.Helper()
+	if !strings.HasPrefix(got, prefix) {
+		t.Errorf("got %q, want prefix %q", got, prefix)
+	}
+}
+
 func assertCalls(t *testing.T, got int, want int) {
 	t.Helper()
 	if got != want {
@@ -0,0 +1,102 @@
+package user
+
+import (
+	"api/mailer"
+	"api/signer"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrInvalidVerificationToken error const for unknown, expired or already used links
+const ErrInvalidVerificationToken = "Invalid or expired verification link"
+
+// EmailVerified message const
+const EmailVerified = "Email verified"
+
+// DefaultVerificationTTL used when Server.VerificationTTL is not set
+const DefaultVerificationTTL = 24 * time.Hour
+
+const verifyEmailPurpose = "verify-email"
+
+// sendVerificationEmail mails a signed link that verifies the user's email once
+func sendVerificationEmail(u *Server, user DatabaseModel) error {
+	if u.Mailer == nil {
+		return nil
+	}
+
+	ttl := u.VerificationTTL
+	if ttl == 0 {
+		ttl = DefaultVerificationTTL
+	}
+
+	token, err := u.Signer.Sign(signer.Claims{
+		Subject:   user.Email,
+		Purpose:   verifyEmailPurpose,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/users/verify?token=%s", u.BaseURL, url.QueryEscape(token))
+	return u.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Hi %s,\n\nConfirm your email by opening the link below:\n\n%s\n", user.Name, link),
+	})
+}
+
+// handleVerifyEmail marks the link's user as verified and revokes the link
+func handleVerifyEmail(u *Server, w http.ResponseWriter, req *http.Request) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		err := ErrMissingParam("token")
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	claims, verifyErr := u.Verifier.Verify(token)
+	if verifyErr != nil || claims.Purpose != verifyEmailPurpose {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidVerificationToken)
+		return
+	}
+
+	updateErr := u.Store.setVerified(claims.Subject, true)
+
+	if updateErr == ErrUserNotFound {
+		respondWithError(w, http.StatusBadRequest, ErrInvalidVerificationToken)
+		return
+	}
+
+	if updateErr != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	if err := u.Revoker.Revoke(claims); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, EmailVerified)
+}
+
+// handleResendVerification mails a new link to the authenticated user
+func handleResendVerification(u *Server, w http.ResponseWriter, req *http.Request) {
+	user, _ := AuthenticatedUser(req.Context())
+
+	if user.Verified {
+		respondWithError(w, http.StatusConflict, EmailVerified)
+		return
+	}
+
+	if err := sendVerificationEmail(u, user); err != nil {
+		respondWithError(w, http.StatusInternalServerError, ErrInternalServer)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
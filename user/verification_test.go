@@ -0,0 +1,140 @@
+package user
+
+import (
+	"api/mailer"
+	"api/signer"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MailerSpy struct {
+	messages     []mailer.Message
+	defaultError error
+}
+
+func (m *MailerSpy) Send(message mailer.Message) error {
+	m.messages = append(m.messages, message)
+	return m.defaultError
+}
+
+func TestRegisterSendsVerificationEmail(t *testing.T) {
+	t.Run("Mails a verification link signed for the new user", func(t *testing.T) {
+		sut, _, _, signerSpy := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		sut.BaseURL = "http://localhost:5000"
+		signerSpy.respondWith("signed_token")
+
+		makeRequestForRegistration(t, sut, makeValidBody())
+
+		assertCalls(t, len(mail.messages), 1)
+		assertString(t, mail.messages[0].To, "email@mail.com")
+		assertString(t, signerSpy.signedClaims.Subject, "email@mail.com")
+		assertString(t, signerSpy.signedClaims.Purpose, verifyEmailPurpose)
+
+		if !strings.Contains(mail.messages[0].Body, "http://localhost:5000/users/verify?token=signed_token") {
+			t.Errorf("got %q, want verification link", mail.messages[0].Body)
+		}
+	})
+
+	t.Run("Still registers the user when the email fails", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+		sut.Mailer = &MailerSpy{defaultError: errors.New("any-error")}
+
+		response := makeRequestForRegistration(t, sut, makeValidBody())
+
+		assertStatusCode(t, response.Code, http.StatusCreated)
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Run("Delivers 422 status code on missing token", func(t *testing.T) {
+		sut, _, _, _ := makeSUT(t)
+
+		response := makeVerifyRequest(t, sut, "")
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Delivers 400 on invalid, expired or reused token", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Verifier = &VerifierSpy{defaultError: signer.ErrRevokedToken}
+
+		response := makeVerifyRequest(t, sut, "any-token")
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertError(t, response.Body.String(), ErrInvalidVerificationToken)
+		assertString(t, store.verifiedEmail, "")
+	})
+
+	t.Run("Delivers 400 on tokens issued for another purpose", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "any-id"}}
+
+		response := makeVerifyRequest(t, sut, "any-token")
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertString(t, store.verifiedEmail, "")
+	})
+
+	t.Run("Marks user verified and revokes the link", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "email@mail.com", Purpose: verifyEmailPurpose, ID: "link-id"}}
+
+		response := makeVerifyRequest(t, sut, "any-token")
+
+		revoker := sut.Revoker.(*RevokerSpy)
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertError(t, response.Body.String(), EmailVerified)
+		assertString(t, store.verifiedEmail, "email@mail.com")
+		assertCalls(t, len(revoker.revokedClaims), 1)
+		assertString(t, revoker.revokedClaims[0].ID, "link-id")
+	})
+
+	t.Run("Delivers 500 on store failure", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		sut.Verifier = &VerifierSpy{claims: signer.Claims{Subject: "email@mail.com", Purpose: verifyEmailPurpose}}
+		store.updateError = errors.New("any-error")
+
+		response := makeVerifyRequest(t, sut, "any-token")
+
+		assertStatusCode(t, response.Code, http.StatusInternalServerError)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	t.Run("Mails a new link to unverified users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.foundUser = DatabaseModel{Email: "email@mail.com"}
+
+		response := makeAuthenticatedPost(t, sut, "/users/verify/resend", "")
+
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertCalls(t, len(mail.messages), 1)
+	})
+
+	t.Run("Delivers 409 to verified users", func(t *testing.T) {
+		sut, _, store, _ := makeSUT(t)
+		mail := &MailerSpy{}
+		sut.Mailer = mail
+		store.foundUser = DatabaseModel{Email: "email@mail.com", Verified: true}
+
+		response := makeAuthenticatedPost(t, sut, "/users/verify/resend", "")
+
+		assertStatusCode(t, response.Code, http.StatusConflict)
+		assertCalls(t, len(mail.messages), 0)
+	})
+}
+
+func makeVerifyRequest(t *testing.T, sut Server, token string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, "/users/verify?token="+token, nil)
+	response := httptest.NewRecorder()
+	sut.ServeHTTP(response, request)
+
+	return response
+}